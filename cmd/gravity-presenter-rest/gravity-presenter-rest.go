@@ -1,12 +1,14 @@
 package main
 
 import (
+	"flag"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	app "github.com/BrobridgeOrg/gravity-presenter-rest/pkg/app/instance"
+	presenter "github.com/BrobridgeOrg/gravity-presenter-rest/pkg/http_server/presenter"
 )
 
 func init() {
@@ -28,6 +30,19 @@ func init() {
 
 func main() {
 
+	openapi := flag.String("openapi", "", "write OpenAPI document of endpoints to file and exit")
+	flag.Parse()
+
+	// Generating API specification only
+	if len(*openapi) > 0 {
+		err := presenter.ExportOpenAPI(viper.GetString("service.settingsPath"), *openapi)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
 	// Initializing application
 	a := app.NewAppInstance()
 
@@ -43,4 +58,6 @@ func main() {
 		log.Fatal(err)
 		return
 	}
+
+	a.Uninit()
 }
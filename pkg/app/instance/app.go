@@ -1,9 +1,16 @@
 package instance
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	http_server "github.com/BrobridgeOrg/gravity-presenter-rest/pkg/http_server/server"
 	mux_manager "github.com/BrobridgeOrg/gravity-presenter-rest/pkg/mux_manager/manager"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
 )
 
 type AppInstance struct {
@@ -40,7 +47,23 @@ func (a *AppInstance) Init() error {
 	return nil
 }
 
+// Uninit stops serving and waits for requests in progress
 func (a *AppInstance) Uninit() {
+
+	log.Info("Shutting down application")
+
+	timeout := viper.GetDuration("service.shutdownTimeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := a.httpServer.Shutdown(ctx)
+	if err != nil {
+		log.Error(err)
+	}
 }
 
 func (a *AppInstance) Run() error {
@@ -58,7 +81,17 @@ func (a *AppInstance) Run() error {
 		return err
 	}
 
-	<-a.done
+	// Waiting for signals to shutdown
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	select {
+	case <-a.done:
+	case s := <-sig:
+		log.WithFields(log.Fields{
+			"signal": s,
+		}).Info("Received signal")
+	}
 
 	return nil
 }
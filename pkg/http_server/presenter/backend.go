@@ -0,0 +1,35 @@
+package presenter
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+)
+
+const (
+	BACKEND_QUERYKIT = "querykit"
+	BACKEND_FIXTURE  = "fixture"
+)
+
+// Backend runs queries with conditions which are resolved by scripts
+type Backend interface {
+	Init(section string) error
+	Query(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error)
+	Timeout() time.Duration
+	Stats() interface{}
+	Close(ctx context.Context) error
+}
+
+func NewBackend(name string) (Backend, error) {
+
+	switch name {
+	case "", BACKEND_QUERYKIT:
+		return NewQueryAdapter(), nil
+	case BACKEND_FIXTURE:
+		return NewFixtureBackend(), nil
+	}
+
+	return nil, fmt.Errorf("Unknown backend \"%s\"", name)
+}
@@ -0,0 +1,170 @@
+package presenter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrCircuitOpen = errors.New("Circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BREAKER_CLOSED BreakerState = iota
+	BREAKER_OPEN
+	BREAKER_HALF_OPEN
+)
+
+var breakerStates = map[BreakerState]string{
+	BREAKER_CLOSED:    "closed",
+	BREAKER_OPEN:      "open",
+	BREAKER_HALF_OPEN: "half_open",
+}
+
+// CircuitBreaker fails fast after consecutive failures, and a probe is allowed after cooldown
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	state      BreakerState
+	failures   int
+	openedAt   time.Time
+	probing    bool
+	generation uint64
+	mutex      sync.Mutex
+}
+
+type BreakerStats struct {
+	State    string `json:"state"`
+	Failures int    `json:"failures"`
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BREAKER_CLOSED,
+	}
+}
+
+// Allow checks whether call can be made, Done should be called with the returned generation
+// and result if it is allowed. Generation changes whenever state changes, so results of calls
+// which were started in previous state are ignored.
+func (cb *CircuitBreaker) Allow() (uint64, error) {
+
+	if cb.threshold <= 0 {
+		return 0, nil
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	switch cb.state {
+	case BREAKER_OPEN:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return 0, ErrCircuitOpen
+		}
+
+		cb.setState(BREAKER_HALF_OPEN)
+	case BREAKER_HALF_OPEN:
+		// Only one probe at the same time
+		if cb.probing {
+			return 0, ErrCircuitOpen
+		}
+	default:
+		return cb.generation, nil
+	}
+
+	cb.probing = true
+
+	return cb.generation, nil
+}
+
+// Done records result of call which was allowed in specific generation
+func (cb *CircuitBreaker) Done(generation uint64, err error) {
+
+	if cb.threshold <= 0 {
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	// Call was started before state changed, only the probe decides state of half open
+	if generation != cb.generation {
+		return
+	}
+
+	if cb.state == BREAKER_HALF_OPEN {
+		cb.probing = false
+	}
+
+	if err == nil {
+		cb.failures = 0
+		if cb.state != BREAKER_CLOSED {
+			cb.setState(BREAKER_CLOSED)
+		}
+
+		return
+	}
+
+	// Errors which are not caused by server are ignored
+	if !isServerFailure(err) {
+		return
+	}
+
+	cb.failures++
+	if cb.state == BREAKER_HALF_OPEN || cb.failures >= cb.threshold {
+		cb.setState(BREAKER_OPEN)
+		cb.openedAt = time.Now()
+	}
+}
+
+func (cb *CircuitBreaker) setState(state BreakerState) {
+	cb.state = state
+	cb.generation++
+}
+
+func (cb *CircuitBreaker) Stats() *BreakerStats {
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return &BreakerStats{
+		State:    breakerStates[cb.state],
+		Failures: cb.failures,
+	}
+}
+
+// isTransient returns true if call can be retried
+func isTransient(err error) bool {
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted:
+		return true
+	}
+
+	return false
+}
+
+// isServerFailure returns true if querykit failed to serve call, errors which are not
+// gRPC status of server are ignored
+func isServerFailure(err error) bool {
+	return isTransient(err) || status.Code(err) == codes.DeadlineExceeded
+}
+
+// callerError replaces error of call with error of context if context of caller is done,
+// because deadline and cancellation of callers are not failures of querykit
+func callerError(ctx context.Context, err error) error {
+
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
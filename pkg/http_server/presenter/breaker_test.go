@@ -0,0 +1,210 @@
+package presenter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUnavailable = status.Error(codes.Unavailable, "unavailable")
+
+func openBreaker(t *testing.T, cb *CircuitBreaker) {
+
+	for i := 0; i < cb.threshold; i++ {
+		generation, err := cb.Allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cb.Done(generation, errUnavailable)
+	}
+
+	if cb.Stats().State != "open" {
+		t.Fatalf("state = %s, want open", cb.Stats().State)
+	}
+}
+
+func TestBreakerOpens(t *testing.T) {
+
+	cb := NewCircuitBreaker(3, time.Hour)
+
+	for i := 0; i < 2; i++ {
+		generation, _ := cb.Allow()
+		cb.Done(generation, errUnavailable)
+	}
+
+	// Errors of clients don't count
+	generation, _ := cb.Allow()
+	cb.Done(generation, errors.New("invalid"))
+
+	if cb.Stats().State != "closed" || cb.Stats().Failures != 2 {
+		t.Fatalf("stats = %+v, want closed with 2 failures", cb.Stats())
+	}
+
+	generation, _ = cb.Allow()
+	cb.Done(generation, errUnavailable)
+
+	if _, err := cb.Allow(); err != ErrCircuitOpen {
+		t.Errorf("error = %v, want %v", err, ErrCircuitOpen)
+	}
+}
+
+func TestBreakerSingleProbe(t *testing.T) {
+
+	cb := NewCircuitBreaker(1, 10*time.Millisecond)
+
+	// Call is started while breaker is closed
+	slow, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openBreaker(t, cb)
+	time.Sleep(20 * time.Millisecond)
+
+	probe, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cb.Stats().State != "half_open" {
+		t.Fatalf("state = %s, want half_open", cb.Stats().State)
+	}
+
+	// Result of call which was started before doesn't decide the probe
+	cb.Done(slow, nil)
+
+	if cb.Stats().State != "half_open" {
+		t.Fatalf("state = %s after stale call, want half_open", cb.Stats().State)
+	}
+
+	if _, err := cb.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("another probe is allowed, error = %v", err)
+	}
+
+	cb.Done(probe, nil)
+
+	if cb.Stats().State != "closed" {
+		t.Fatalf("state = %s, want closed", cb.Stats().State)
+	}
+
+	if _, err := cb.Allow(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBreakerProbeFails(t *testing.T) {
+
+	cb := NewCircuitBreaker(1, 10*time.Millisecond)
+
+	openBreaker(t, cb)
+	time.Sleep(20 * time.Millisecond)
+
+	probe, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb.Done(probe, errUnavailable)
+
+	if cb.Stats().State != "open" {
+		t.Fatalf("state = %s, want open", cb.Stats().State)
+	}
+
+	if _, err := cb.Allow(); err != ErrCircuitOpen {
+		t.Errorf("error = %v, want %v before cooldown", err, ErrCircuitOpen)
+	}
+
+	// Stale probe doesn't close breaker which is opened again
+	cb.Done(probe, nil)
+
+	if cb.Stats().State != "open" {
+		t.Errorf("state = %s, want open", cb.Stats().State)
+	}
+}
+
+func TestBreakerProbeClientError(t *testing.T) {
+
+	cb := NewCircuitBreaker(1, 10*time.Millisecond)
+
+	openBreaker(t, cb)
+	time.Sleep(20 * time.Millisecond)
+
+	probe, err := cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Probe failed by client tells nothing, so another probe is allowed
+	cb.Done(probe, errors.New("invalid"))
+
+	if cb.Stats().State != "half_open" {
+		t.Fatalf("state = %s, want half_open", cb.Stats().State)
+	}
+
+	probe, err = cb.Allow()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb.Done(probe, nil)
+
+	if cb.Stats().State != "closed" {
+		t.Errorf("state = %s, want closed", cb.Stats().State)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+
+	cb := NewCircuitBreaker(0, time.Hour)
+
+	for i := 0; i < 10; i++ {
+		generation, err := cb.Allow()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cb.Done(generation, errUnavailable)
+	}
+
+	if cb.Stats().State != "closed" {
+		t.Errorf("state = %s, want closed", cb.Stats().State)
+	}
+}
+
+func TestBreakerIgnoresCallerErrors(t *testing.T) {
+
+	cb := NewCircuitBreaker(1, time.Hour)
+
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	// Deadline of caller, either from context or from gRPC client, is not a failure of querykit
+	errs := []error{
+		context.DeadlineExceeded,
+		context.Canceled,
+		callerError(expired, status.Error(codes.DeadlineExceeded, "context deadline exceeded")),
+		callerError(expired, errUnavailable),
+	}
+
+	for _, err := range errs {
+		generation, _ := cb.Allow()
+		cb.Done(generation, err)
+	}
+
+	if cb.Stats().State != "closed" || cb.Stats().Failures != 0 {
+		t.Fatalf("stats = %+v, want closed without failures", cb.Stats())
+	}
+
+	// Deadline exceeded by server
+	generation, _ := cb.Allow()
+	cb.Done(generation, callerError(context.Background(), status.Error(codes.DeadlineExceeded, "timeout")))
+
+	if cb.Stats().State != "open" {
+		t.Errorf("state = %s, want open", cb.Stats().State)
+	}
+}
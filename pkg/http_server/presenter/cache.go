@@ -0,0 +1,107 @@
+package presenter
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+)
+
+const defaultCacheSize = 1024
+
+type CacheConfig struct {
+	TTL  string `json:"ttl"`
+	Size int    `json:"size"`
+}
+
+// QueryCache is a LRU cache of query results which expire after TTL
+type QueryCache struct {
+	ttl     time.Duration
+	size    int
+	entries map[string]*list.Element
+	order   *list.List
+	mutex   sync.Mutex
+}
+
+type cacheEntry struct {
+	key     string
+	reply   *querykit.QueryReply
+	expires time.Time
+}
+
+func NewQueryCache(config *CacheConfig) (*QueryCache, error) {
+
+	if len(config.TTL) == 0 {
+		return nil, errors.New("Required TTL for cache")
+	}
+
+	ttl, err := time.ParseDuration(config.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	size := config.Size
+	if size <= 0 {
+		size = defaultCacheSize
+	}
+
+	return &QueryCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}, nil
+}
+
+func (cache *QueryCache) Get(key string) (*querykit.QueryReply, bool) {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	ele, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := ele.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cache.remove(ele)
+		return nil, false
+	}
+
+	cache.order.MoveToFront(ele)
+
+	return entry.reply, true
+}
+
+func (cache *QueryCache) Set(key string, reply *querykit.QueryReply) {
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if ele, ok := cache.entries[key]; ok {
+		entry := ele.Value.(*cacheEntry)
+		entry.reply = reply
+		entry.expires = time.Now().Add(cache.ttl)
+		cache.order.MoveToFront(ele)
+		return
+	}
+
+	cache.entries[key] = cache.order.PushFront(&cacheEntry{
+		key:     key,
+		reply:   reply,
+		expires: time.Now().Add(cache.ttl),
+	})
+
+	// Evict the least recently used entries
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+func (cache *QueryCache) remove(ele *list.Element) {
+	cache.order.Remove(ele)
+	delete(cache.entries, ele.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,261 @@
+package presenter
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+)
+
+// EncodeValue converts value of scripts and fixtures to querykit value.
+//
+// Integers, unsigned integers and floats are 8 bytes in little endian, booleans are
+// a single byte, timestamps are strings in RFC 3339. Null elements of arrays are
+// empty binaries because querykit has no null type.
+func EncodeValue(data interface{}) (*querykit.Value, error) {
+
+	if data == nil {
+		return nil, nil
+	}
+
+	switch v := data.(type) {
+	case *querykit.Value:
+		return v, nil
+	case []byte:
+		return &querykit.Value{
+			Type:  querykit.DataType_BINARY,
+			Value: v,
+		}, nil
+	case time.Time:
+		return &querykit.Value{
+			Type:  querykit.DataType_STRING,
+			Value: []byte(v.Format(time.RFC3339Nano)),
+		}, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return EncodeValue(i)
+		}
+
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+
+		return EncodeValue(f)
+	}
+
+	v := reflect.ValueOf(data)
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b := byte(0)
+		if v.Bool() {
+			b = 1
+		}
+
+		return &querykit.Value{
+			Type:  querykit.DataType_BOOLEAN,
+			Value: []byte{b},
+		}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &querykit.Value{
+			Type:  querykit.DataType_INT64,
+			Value: encodeUint64(uint64(v.Int())),
+		}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &querykit.Value{
+			Type:  querykit.DataType_UINT64,
+			Value: encodeUint64(v.Uint()),
+		}, nil
+	case reflect.Float32, reflect.Float64:
+		return &querykit.Value{
+			Type:  querykit.DataType_FLOAT64,
+			Value: encodeUint64(math.Float64bits(v.Float())),
+		}, nil
+	case reflect.String:
+		return &querykit.Value{
+			Type:  querykit.DataType_STRING,
+			Value: []byte(v.String()),
+		}, nil
+	case reflect.Map:
+		return encodeMap(v)
+	case reflect.Slice, reflect.Array:
+		return encodeArray(v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		return EncodeValue(v.Elem().Interface())
+	case reflect.Struct:
+		// Structs are encoded as their JSON representation
+		data, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		var obj interface{}
+		err = json.Unmarshal(data, &obj)
+		if err != nil {
+			return nil, err
+		}
+
+		return EncodeValue(obj)
+	}
+
+	return nil, fmt.Errorf("Unsupported type of value: %T", data)
+}
+
+func encodeUint64(n uint64) []byte {
+
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, n)
+
+	return buf
+}
+
+func encodeMap(v reflect.Value) (*querykit.Value, error) {
+
+	// Fields are sorted by name for stable encoding
+	keys := v.MapKeys()
+	names := make([]string, 0, len(keys))
+	values := make(map[string]reflect.Value, len(keys))
+	for _, key := range keys {
+		name := fmt.Sprint(key.Interface())
+		names = append(names, name)
+		values[name] = v.MapIndex(key)
+	}
+
+	sort.Strings(names)
+
+	value := &querykit.MapValue{
+		Fields: make([]*querykit.Field, 0, len(names)),
+	}
+
+	for _, name := range names {
+
+		ele, err := EncodeValue(values[name].Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		value.Fields = append(value.Fields, &querykit.Field{
+			Name:  name,
+			Value: ele,
+		})
+	}
+
+	return &querykit.Value{
+		Type: querykit.DataType_MAP,
+		Map:  value,
+	}, nil
+}
+
+func encodeArray(v reflect.Value) (*querykit.Value, error) {
+
+	value := &querykit.ArrayValue{
+		Elements: make([]*querykit.Value, 0, v.Len()),
+	}
+
+	for i := 0; i < v.Len(); i++ {
+
+		ele, err := EncodeValue(v.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+
+		if ele == nil {
+			ele = &querykit.Value{
+				Type: querykit.DataType_BINARY,
+			}
+		}
+
+		value.Elements = append(value.Elements, ele)
+	}
+
+	return &querykit.Value{
+		Type:  querykit.DataType_ARRAY,
+		Array: value,
+	}, nil
+}
+
+// DecodeValue converts querykit value to value for templates and scripts, which are
+// int64, uint64, float64, bool, string, []byte, []interface{} and map[string]interface{}
+func DecodeValue(value *querykit.Value) interface{} {
+
+	if value == nil {
+		return nil
+	}
+
+	switch value.Type {
+	case querykit.DataType_BOOLEAN:
+		return len(value.Value) > 0 && value.Value[0] != 0
+	case querykit.DataType_STRING:
+		return string(value.Value)
+	case querykit.DataType_UINT64:
+		return decodeUint64(value.Value)
+	case querykit.DataType_INT64:
+		return int64(decodeUint64(value.Value))
+	case querykit.DataType_FLOAT64:
+		return math.Float64frombits(decodeUint64(value.Value))
+	case querykit.DataType_ARRAY:
+		return decodeArray(value.Array)
+	case querykit.DataType_MAP:
+		return decodeMap(value.Map)
+	case querykit.DataType_BINARY:
+		// Empty binaries are null
+		if len(value.Value) == 0 {
+			return nil
+		}
+
+		return value.Value
+	}
+
+	return nil
+}
+
+// decodeUint64 decodes little endian number, which is padded if it is shorter than 8 bytes
+func decodeUint64(data []byte) uint64 {
+
+	if len(data) >= 8 {
+		return binary.LittleEndian.Uint64(data)
+	}
+
+	buf := make([]byte, 8)
+	copy(buf, data)
+
+	return binary.LittleEndian.Uint64(buf)
+}
+
+func decodeArray(array *querykit.ArrayValue) []interface{} {
+
+	if array == nil {
+		return make([]interface{}, 0)
+	}
+
+	elements := make([]interface{}, 0, len(array.Elements))
+	for _, ele := range array.Elements {
+		elements = append(elements, DecodeValue(ele))
+	}
+
+	return elements
+}
+
+func decodeMap(m *querykit.MapValue) map[string]interface{} {
+
+	if m == nil {
+		return make(map[string]interface{})
+	}
+
+	obj := make(map[string]interface{}, len(m.Fields))
+	for _, field := range m.Fields {
+		obj[field.Name] = DecodeValue(field.Value)
+	}
+
+	return obj
+}
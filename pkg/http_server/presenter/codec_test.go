@@ -0,0 +1,216 @@
+package presenter
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		dataType querykit.DataType
+		want     interface{}
+	}{
+		{"true", true, querykit.DataType_BOOLEAN, true},
+		{"false", false, querykit.DataType_BOOLEAN, false},
+		{"string", "hello", querykit.DataType_STRING, "hello"},
+		{"empty string", "", querykit.DataType_STRING, ""},
+		{"unicode string", "中文", querykit.DataType_STRING, "中文"},
+		{"int", 42, querykit.DataType_INT64, int64(42)},
+		{"int8", int8(-8), querykit.DataType_INT64, int64(-8)},
+		{"min int64", int64(math.MinInt64), querykit.DataType_INT64, int64(math.MinInt64)},
+		{"max int64", int64(math.MaxInt64), querykit.DataType_INT64, int64(math.MaxInt64)},
+		{"uint", uint(7), querykit.DataType_UINT64, uint64(7)},
+		{"max uint64", uint64(math.MaxUint64), querykit.DataType_UINT64, uint64(math.MaxUint64)},
+		{"float32", float32(1.5), querykit.DataType_FLOAT64, float64(1.5)},
+		{"float64", 3.14159, querykit.DataType_FLOAT64, 3.14159},
+		{"max float64", math.MaxFloat64, querykit.DataType_FLOAT64, math.MaxFloat64},
+		{"json integer", json.Number("9007199254740993"), querykit.DataType_INT64, int64(9007199254740993)},
+		{"json float", json.Number("1.25"), querykit.DataType_FLOAT64, 1.25},
+		{"bytes", []byte{0, 1, 255}, querykit.DataType_BINARY, []byte{0, 1, 255}},
+		{"time", time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC), querykit.DataType_STRING, "2021-03-04T05:06:07.000000008Z"},
+		{"array", []interface{}{int64(1), "a", true}, querykit.DataType_ARRAY, []interface{}{int64(1), "a", true}},
+		{"typed array", []string{"a", "b"}, querykit.DataType_ARRAY, []interface{}{"a", "b"}},
+		{"empty array", []interface{}{}, querykit.DataType_ARRAY, []interface{}{}},
+		{"array with null", []interface{}{nil, "a"}, querykit.DataType_ARRAY, []interface{}{nil, "a"}},
+		{"map", map[string]interface{}{"a": int64(1), "b": "x"}, querykit.DataType_MAP, map[string]interface{}{"a": int64(1), "b": "x"}},
+		{"empty map", map[string]interface{}{}, querykit.DataType_MAP, map[string]interface{}{}},
+		{"map with null", map[string]interface{}{"a": nil}, querykit.DataType_MAP, map[string]interface{}{"a": nil}},
+		{
+			"nested",
+			map[string]interface{}{
+				"id":   uint64(math.MaxUint64),
+				"tags": []interface{}{"a", map[string]interface{}{"deep": []interface{}{1.5, []byte("b")}}},
+				"info": map[string]interface{}{"ok": true, "list": []interface{}{}},
+			},
+			querykit.DataType_MAP,
+			map[string]interface{}{
+				"id":   uint64(math.MaxUint64),
+				"tags": []interface{}{"a", map[string]interface{}{"deep": []interface{}{1.5, []byte("b")}}},
+				"info": map[string]interface{}{"ok": true, "list": []interface{}{}},
+			},
+		},
+		{
+			"struct",
+			struct {
+				Name  string `json:"name"`
+				Count int    `json:"count"`
+			}{"a", 2},
+			querykit.DataType_MAP,
+			map[string]interface{}{"name": "a", "count": float64(2)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			value, err := EncodeValue(test.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if value.Type != test.dataType {
+				t.Errorf("type = %v, want %v", value.Type, test.dataType)
+			}
+
+			result := DecodeValue(value)
+			if !reflect.DeepEqual(result, test.want) {
+				t.Errorf("decoded = %#v, want %#v", result, test.want)
+			}
+		})
+	}
+}
+
+func TestCodecNull(t *testing.T) {
+
+	var ptr *int
+
+	for _, data := range []interface{}{nil, ptr} {
+		value, err := EncodeValue(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != nil {
+			t.Errorf("%#v is encoded as %v, want nil", data, value)
+		}
+	}
+
+	if DecodeValue(nil) != nil {
+		t.Error("nil value is not decoded as nil")
+	}
+
+	// Empty binary is null, because querykit has no null type
+	if v := DecodeValue(&querykit.Value{Type: querykit.DataType_BINARY}); v != nil {
+		t.Errorf("empty binary is decoded as %#v", v)
+	}
+}
+
+func TestCodecPointer(t *testing.T) {
+
+	n := int64(5)
+
+	value, err := EncodeValue(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result := DecodeValue(value); result != int64(5) {
+		t.Errorf("decoded = %#v", result)
+	}
+}
+
+func TestCodecUnsupported(t *testing.T) {
+
+	if _, err := EncodeValue(make(chan int)); err == nil {
+		t.Error("channel is expected to be unsupported")
+	}
+
+	if _, err := EncodeValue([]interface{}{func() {}}); err == nil {
+		t.Error("function in array is expected to be unsupported")
+	}
+}
+
+func TestDecodeShortNumber(t *testing.T) {
+
+	// Numbers shorter than 8 bytes are padded
+	value := &querykit.Value{
+		Type:  querykit.DataType_INT64,
+		Value: []byte{1, 1},
+	}
+
+	if result := DecodeValue(value); result != int64(257) {
+		t.Errorf("decoded = %#v, want 257", result)
+	}
+}
+
+func TestCodecProperty(t *testing.T) {
+
+	roundTrip := func(data interface{}) interface{} {
+
+		value, err := EncodeValue(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return DecodeValue(value)
+	}
+
+	checks := []interface{}{
+		func(v int64) bool { return roundTrip(v) == v },
+		func(v uint64) bool { return roundTrip(v) == v },
+		func(v float64) bool { return roundTrip(v) == v },
+		func(v bool) bool { return roundTrip(v) == v },
+		func(v string) bool { return roundTrip(v) == v },
+		func(v []byte) bool {
+			// Empty binary is null
+			if len(v) == 0 {
+				return roundTrip(v) == nil
+			}
+
+			return reflect.DeepEqual(roundTrip(v), v)
+		},
+		func(v map[string]int64) bool {
+			obj := roundTrip(v).(map[string]interface{})
+			if len(obj) != len(v) {
+				return false
+			}
+
+			for key, n := range v {
+				if obj[key] != n {
+					return false
+				}
+			}
+
+			return true
+		},
+		func(v []string) bool {
+			elements := roundTrip(v).([]interface{})
+			if len(elements) != len(v) {
+				return false
+			}
+
+			for i, s := range v {
+				if elements[i] != s {
+					return false
+				}
+			}
+
+			return true
+		},
+	}
+
+	for _, check := range checks {
+		if err := quick.Check(check, nil); err != nil {
+			t.Error(err)
+		}
+	}
+}
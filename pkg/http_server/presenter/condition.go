@@ -1,23 +1,502 @@
 package presenter
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
+
 	"github.com/dop251/goja"
 )
 
+// operators are supported by conditions, "in", "notIn" and "between" are expanded to
+// native operators of querykit, "startsWith" and "contains" are evaluated by presenter
+var operators = map[string]bool{
+	"":           true,
+	"=":          true,
+	"==":         true,
+	"!=":         true,
+	">":          true,
+	">=":         true,
+	"<":          true,
+	"<=":         true,
+	"&&":         true,
+	"||":         true,
+	"isExist":    true,
+	"in":         true,
+	"notIn":      true,
+	"between":    true,
+	"startsWith": true,
+	"contains":   true,
+}
+
 type Condition struct {
 	Name       string       `json:"name"`
 	Field      string       `json:"field"`
 	Value      interface{}  `json:"value"`
 	Operator   string       `json:"operator"`
+	Optional   bool         `json:"optional"`
 	Conditions []*Condition `json:"conditions"`
-	Runtime    *goja.Runtime
+
+	valueProgram *goja.Program
+	fieldProgram *goja.Program
 }
 
 func NewCondition() *Condition {
 	return &Condition{}
 }
 
-func (condition *Condition) InitRuntime() {
-	condition.Runtime = goja.New()
-	condition.Runtime.SetFieldNameMapper(goja.UncapFieldNameMapper())
+func (condition *Condition) Compile() error {
+
+	if !operators[condition.Operator] {
+		return fmt.Errorf("Unknown operator \"%s\"", condition.Operator)
+	}
+
+	if script, ok := condition.Value.(string); ok {
+		program, err := CompileScript("value", script)
+		if err != nil {
+			return err
+		}
+
+		condition.valueProgram = program
+	}
+
+	if condition.Field != "" {
+		program, err := CompileScript("field", condition.Field)
+		if err != nil {
+			return err
+		}
+
+		condition.fieldProgram = program
+	}
+
+	return nil
+}
+
+// isAbsentValue returns true if value of optional condition is undefined, null, empty string, array or object
+func isAbsentValue(value interface{}) bool {
+
+	if isEmptyValue(value) {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// alwaysTrue and alwaysFalse are groups without conditions
+func alwaysTrue() *Condition {
+	return &Condition{
+		Operator:   "&&",
+		Conditions: make([]*Condition, 0),
+	}
+}
+
+func alwaysFalse() *Condition {
+	return &Condition{
+		Operator:   "||",
+		Conditions: make([]*Condition, 0),
+	}
+}
+
+func isConstant(condition *Condition, operator string) bool {
+	return condition.Operator == operator && len(condition.Conditions) == 0
+}
+
+// expandCondition rewrites "in", "notIn" and "between" with native operators of querykit
+func expandCondition(condition *Condition) (*Condition, error) {
+
+	if condition == nil {
+		return nil, nil
+	}
+
+	switch condition.Operator {
+	case "&&", "||":
+		group := &Condition{
+			Operator:   condition.Operator,
+			Conditions: make([]*Condition, 0, len(condition.Conditions)),
+		}
+
+		for _, child := range condition.Conditions {
+			c, err := expandCondition(child)
+			if err != nil {
+				return nil, err
+			}
+
+			group.Conditions = append(group.Conditions, c)
+		}
+
+		return simplifyCondition(group), nil
+	case "in", "notIn":
+		values := conditionValues(condition.Value)
+
+		group := &Condition{
+			Operator:   "||",
+			Conditions: make([]*Condition, 0, len(values)),
+		}
+
+		operator := "="
+		if condition.Operator == "notIn" {
+			group.Operator = "&&"
+			operator = "!="
+		}
+
+		for _, value := range values {
+			group.Conditions = append(group.Conditions, &Condition{
+				Name:     condition.Name,
+				Operator: operator,
+				Value:    value,
+			})
+		}
+
+		return simplifyCondition(group), nil
+	case "between":
+		values := conditionValues(condition.Value)
+		if len(values) != 2 {
+			return nil, fmt.Errorf("Operator \"between\" of \"%s\" requires two values", condition.Name)
+		}
+
+		return &Condition{
+			Operator: "&&",
+			Conditions: []*Condition{
+				{Name: condition.Name, Operator: ">=", Value: values[0]},
+				{Name: condition.Name, Operator: "<=", Value: values[1]},
+			},
+		}, nil
+	}
+
+	return condition, nil
+}
+
+// conditionValues returns elements of array or comma-separated string, or the value itself
+func conditionValues(value interface{}) []interface{} {
+
+	if value == nil {
+		return make([]interface{}, 0)
+	}
+
+	// Value from query string, e.g. "?ids=1,2,3"
+	if s, ok := value.(string); ok {
+		values := make([]interface{}, 0)
+		for _, element := range strings.Split(s, ",") {
+			if element = strings.TrimSpace(element); len(element) > 0 {
+				values = append(values, element)
+			}
+		}
+
+		return values
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []interface{}{value}
+	}
+
+	if _, ok := value.([]byte); ok {
+		return []interface{}{value}
+	}
+
+	values := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		values = append(values, v.Index(i).Interface())
+	}
+
+	return values
+}
+
+// simplifyCondition removes constant conditions from group, and group of single condition is the condition
+func simplifyCondition(group *Condition) *Condition {
+
+	// Constant which is ignored by group, and constant which decides result of group
+	identity, absorbing := alwaysTrue(), alwaysFalse()
+	if group.Operator == "||" {
+		identity, absorbing = absorbing, identity
+	}
+
+	conditions := make([]*Condition, 0, len(group.Conditions))
+	for _, c := range group.Conditions {
+
+		if isConstant(c, identity.Operator) {
+			continue
+		}
+
+		if isConstant(c, absorbing.Operator) {
+			return absorbing
+		}
+
+		conditions = append(conditions, c)
+	}
+
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+
+	group.Conditions = conditions
+
+	return group
+}
+
+// pushdownCondition replaces conditions which are evaluated by presenter with true,
+// so querykit returns records which are a superset of matched records, startsWith is sent as range
+func pushdownCondition(condition *Condition) (*Condition, bool) {
+
+	switch condition.Operator {
+	case "&&", "||":
+		group := &Condition{
+			Operator:   condition.Operator,
+			Conditions: make([]*Condition, 0, len(condition.Conditions)),
+		}
+
+		residual := false
+		for _, child := range condition.Conditions {
+			c, r := pushdownCondition(child)
+			group.Conditions = append(group.Conditions, c)
+			residual = residual || r
+		}
+
+		return simplifyCondition(group), residual
+	case "startsWith":
+		return prefixCondition(condition), false
+	case "contains":
+		return alwaysTrue(), true
+	}
+
+	return condition, false
+}
+
+// prefixCondition converts startsWith to range of strings which have the prefix
+func prefixCondition(condition *Condition) *Condition {
+
+	prefix, ok := condition.Value.(string)
+	if !ok {
+		return alwaysFalse()
+	}
+
+	lower := &Condition{
+		Name:     condition.Name,
+		Operator: ">=",
+		Value:    prefix,
+	}
+
+	// Strings which consist of 0xff only have no upper bound
+	upper := prefixSuccessor(prefix)
+	if len(upper) == 0 {
+		return lower
+	}
+
+	return &Condition{
+		Operator: "&&",
+		Conditions: []*Condition{
+			lower,
+			{
+				Name:     condition.Name,
+				Operator: "<",
+				Value:    upper,
+			},
+		},
+	}
+}
+
+// prefixSuccessor returns the smallest string which is greater than all strings with the prefix
+func prefixSuccessor(prefix string) string {
+
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+
+	return ""
+}
+
+// matchCondition evaluates expanded condition tree against record, empty operator is equality
+func matchCondition(record map[string]interface{}, condition *Condition) bool {
+
+	if condition == nil {
+		return true
+	}
+
+	switch condition.Operator {
+	case "&&":
+		for _, child := range condition.Conditions {
+			if !matchCondition(record, child) {
+				return false
+			}
+		}
+
+		return true
+	case "||":
+		for _, child := range condition.Conditions {
+			if matchCondition(record, child) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	value := getValueFromObject(record, condition.Name)
+
+	switch condition.Operator {
+	case "isExist":
+		exists := value != nil
+		if expected, ok := condition.Value.(bool); ok {
+			return exists == expected
+		}
+
+		return exists
+	case "!=":
+		return !equalValue(value, condition.Value)
+	case ">", ">=", "<", "<=":
+		result, ok := compareValue(value, condition.Value)
+		if !ok {
+			return false
+		}
+
+		switch condition.Operator {
+		case ">":
+			return result > 0
+		case ">=":
+			return result >= 0
+		case "<":
+			return result < 0
+		}
+
+		return result <= 0
+	case "startsWith":
+		s, ok := value.(string)
+		prefix, isString := condition.Value.(string)
+
+		return ok && isString && strings.HasPrefix(s, prefix)
+	case "contains":
+		// Substring of string, or element of array
+		if s, ok := value.(string); ok {
+			sub, isString := condition.Value.(string)
+			return isString && strings.Contains(s, sub)
+		}
+
+		if elements, ok := value.([]interface{}); ok {
+			for _, ele := range elements {
+				if equalValue(ele, condition.Value) {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	return equalValue(value, condition.Value)
+}
+
+func equalValue(a interface{}, b interface{}) bool {
+
+	if result, ok := compareValue(a, b); ok {
+		return result == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// lessValue orders values for sorting, null is the first and values which are not comparable keep their order
+func lessValue(a interface{}, b interface{}) bool {
+
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+
+	result, ok := compareValue(a, b)
+
+	return ok && result < 0
+}
+
+// compareValue compares numbers, strings and booleans, false is returned if they are not comparable
+func compareValue(a interface{}, b interface{}) (int, bool) {
+
+	// Integers are compared without losing precision
+	if x, ok := toInt64(a); ok {
+		if y, ok := toInt64(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+
+			return 0, true
+		}
+	}
+
+	if x, ok := toFloat64(a); ok {
+		if y, ok := toFloat64(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+
+			return 0, true
+		}
+	}
+
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			switch {
+			case x == y:
+				return 0, true
+			case y:
+				return -1, true
+			}
+
+			return 1, true
+		}
+	}
+
+	return 0, false
+}
+
+func toInt64(value interface{}) (int64, bool) {
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if v.Uint() > 1<<63-1 {
+			return 0, false
+		}
+
+		return int64(v.Uint()), true
+	}
+
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	}
+
+	return 0, false
 }
@@ -0,0 +1,109 @@
+package presenter
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExpandConditionValues(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		condition *Condition
+		expanded  string
+		err       string
+	}{
+		{"in array", &Condition{Name: "id", Operator: "in", Value: []interface{}{int64(1), int64(2)}}, "(id = 1 || id = 2)", ""},
+		{"in string", &Condition{Name: "id", Operator: "in", Value: "a, b,c"}, "(id = a || id = b || id = c)", ""},
+		{"in single", &Condition{Name: "id", Operator: "in", Value: "a"}, "id = a", ""},
+		{"in empty string", &Condition{Name: "id", Operator: "in", Value: ""}, "false", ""},
+		{"in number", &Condition{Name: "id", Operator: "in", Value: int64(1)}, "id = 1", ""},
+		{"notIn string", &Condition{Name: "id", Operator: "notIn", Value: "a,,b"}, "(id != a && id != b)", ""},
+		{"between string", &Condition{Name: "date", Operator: "between", Value: "2021-01-01,2021-12-31"}, "(date >= 2021-01-01 && date <= 2021-12-31)", ""},
+		{"between one value", &Condition{Name: "date", Operator: "between", Value: "2021-01-01"}, "", `Operator "between" of "date" requires two values`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			expanded, err := expandCondition(test.condition)
+			if len(test.err) > 0 {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s := formatCondition(expanded); s != test.expanded {
+				t.Errorf("expanded = %s, want %s", s, test.expanded)
+			}
+		})
+	}
+}
+
+func TestPushdownCondition(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		condition *Condition
+		pushdown  string
+		residual  bool
+	}{
+		{"native", &Condition{Name: "id", Operator: "=", Value: int64(1)}, "id = 1", false},
+		{"startsWith", &Condition{Name: "name", Operator: "startsWith", Value: "ab"}, "(name >= ab && name < ac)", false},
+		{"startsWith carry", &Condition{Name: "name", Operator: "startsWith", Value: "a\xff"}, "(name >= a\xff && name < b)", false},
+		{"startsWith without upper bound", &Condition{Name: "name", Operator: "startsWith", Value: "\xff\xff"}, "name >= \xff\xff", false},
+		{"startsWith empty", &Condition{Name: "name", Operator: "startsWith", Value: ""}, "name >= ", false},
+		{"startsWith number", &Condition{Name: "name", Operator: "startsWith", Value: int64(1)}, "false", false},
+		{"contains", &Condition{Name: "name", Operator: "contains", Value: "a"}, "true", true},
+		{
+			"group",
+			&Condition{Operator: "&&", Conditions: []*Condition{
+				{Name: "type", Operator: "=", Value: "user"},
+				{Name: "name", Operator: "startsWith", Value: "a"},
+				{Name: "tags", Operator: "contains", Value: "vip"},
+			}},
+			"(type = user && (name >= a && name < b))",
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			pushdown, residual := pushdownCondition(test.condition)
+			if s := formatCondition(pushdown); s != test.pushdown {
+				t.Errorf("pushdown = %s, want %s", s, test.pushdown)
+			}
+
+			if residual != test.residual {
+				t.Errorf("residual = %v, want %v", residual, test.residual)
+			}
+		})
+	}
+}
+
+func formatCondition(condition *Condition) string {
+
+	switch {
+	case isConstant(condition, "&&"):
+		return "true"
+	case isConstant(condition, "||"):
+		return "false"
+	case condition.Operator == "&&" || condition.Operator == "||":
+		conditions := make([]string, 0, len(condition.Conditions))
+		for _, child := range condition.Conditions {
+			conditions = append(conditions, formatCondition(child))
+		}
+
+		return "(" + strings.Join(conditions, " "+condition.Operator+" ") + ")"
+	}
+
+	return fmt.Sprintf("%s %s %v", condition.Name, condition.Operator, condition.Value)
+}
@@ -0,0 +1,198 @@
+package presenter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type CSVRenderConfig struct {
+	Columns   []*CSVColumn `json:"columns"`
+	Header    *bool        `json:"header"`
+	Delimiter string       `json:"delimiter"`
+	Quote     string       `json:"quote"`
+	delimiter rune
+}
+
+// CSVColumn is a column name or an object with path of record
+type CSVColumn struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+func (column *CSVColumn) UnmarshalJSON(data []byte) error {
+
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		column.Name = name
+		return nil
+	}
+
+	type csvColumn CSVColumn
+	return json.Unmarshal(data, (*csvColumn)(column))
+}
+
+func (config *CSVRenderConfig) Init() error {
+
+	for _, column := range config.Columns {
+
+		if len(column.Name) == 0 {
+			return errors.New("Required name for column of CSV render")
+		}
+
+		if len(column.Path) == 0 {
+			column.Path = column.Name
+		}
+	}
+
+	config.delimiter = ','
+	if len(config.Delimiter) > 0 {
+		if utf8.RuneCountInString(config.Delimiter) != 1 {
+			return fmt.Errorf("Delimiter of CSV render should be a character")
+		}
+
+		config.delimiter, _ = utf8.DecodeRuneInString(config.Delimiter)
+	}
+
+	switch config.Quote {
+	case "":
+		config.Quote = "minimal"
+	case "minimal", "all":
+	default:
+		return fmt.Errorf("Unknown quote \"%s\" of CSV render", config.Quote)
+	}
+
+	return nil
+}
+
+// Render writes header and records, records are written once they are decoded
+func (config *CSVRenderConfig) Render(w io.Writer, data *ViewData) error {
+
+	columns := config.Columns
+	header := config.Header == nil || *config.Header
+
+	err := data.eachRecord(func(record map[string]interface{}) error {
+
+		// Columns are fields of the first record if they are not specified
+		if columns == nil {
+			columns = make([]*CSVColumn, 0, len(record))
+			for name := range record {
+				columns = append(columns, &CSVColumn{
+					Name: name,
+					Path: name,
+				})
+			}
+
+			sort.Slice(columns, func(i, j int) bool {
+				return columns[i].Name < columns[j].Name
+			})
+		}
+
+		if header {
+			header = false
+
+			if err := config.writeRow(w, config.columnNames(columns)); err != nil {
+				return err
+			}
+		}
+
+		fields := make([]string, 0, len(columns))
+		for _, column := range columns {
+			fields = append(fields, formatCSVValue(getValueFromObject(record, column.Path)))
+		}
+
+		return config.writeRow(w, fields)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Header is still required without records
+	if header && columns != nil {
+		return config.writeRow(w, config.columnNames(columns))
+	}
+
+	return nil
+}
+
+func (config *CSVRenderConfig) columnNames(columns []*CSVColumn) []string {
+
+	names := make([]string, 0, len(columns))
+	for _, column := range columns {
+		names = append(names, column.Name)
+	}
+
+	return names
+}
+
+func (config *CSVRenderConfig) writeRow(w io.Writer, fields []string) error {
+
+	var buf strings.Builder
+	for i, field := range fields {
+
+		if i > 0 {
+			buf.WriteRune(config.delimiter)
+		}
+
+		if config.Quote != "all" && !config.needsQuotes(field) {
+			buf.WriteString(field)
+			continue
+		}
+
+		buf.WriteByte('"')
+		buf.WriteString(strings.Replace(field, "\"", "\"\"", -1))
+		buf.WriteByte('"')
+	}
+
+	buf.WriteString("\r\n")
+
+	_, err := io.WriteString(w, buf.String())
+
+	return err
+}
+
+func (config *CSVRenderConfig) needsQuotes(field string) bool {
+
+	if len(field) == 0 {
+		return false
+	}
+
+	if field[0] == ' ' || field[0] == '\t' {
+		return true
+	}
+
+	return strings.ContainsRune(field, config.delimiter) || strings.ContainsAny(field, "\"\r\n")
+}
+
+func formatCSVValue(value interface{}) string {
+
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case map[string]interface{}, []interface{}:
+		data, err := marshalJSON(v)
+		if err != nil {
+			return ""
+		}
+
+		return string(data)
+	}
+
+	return fmt.Sprint(value)
+}
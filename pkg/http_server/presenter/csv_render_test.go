@@ -0,0 +1,223 @@
+package presenter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestCSVRender(t *testing.T, source string) *CSVRenderConfig {
+
+	config := &CSVRenderConfig{}
+	if err := json.Unmarshal([]byte(source), config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+func TestCSVRender(t *testing.T) {
+
+	records := []map[string]interface{}{
+		{"id": int64(1), "name": "alice", "note": "a,b;c", "owner": map[string]interface{}{"name": "Alice"}},
+		{"id": int64(2), "name": "say \"hi\"", "note": " lead\nline", "tags": []interface{}{"x", "y"}},
+	}
+
+	tests := []struct {
+		name    string
+		config  string
+		records []map[string]interface{}
+		output  string
+	}{
+		{
+			"default",
+			`{}`,
+			records,
+			"id,name,note,owner\r\n" +
+				"1,alice,\"a,b;c\",\"{\"\"name\"\":\"\"Alice\"\"}\"\r\n" +
+				"2,\"say \"\"hi\"\"\",\" lead\nline\",\r\n",
+		},
+		{
+			"quote all",
+			`{ "columns": [ "id", "name" ], "quote": "all" }`,
+			records,
+			"\"id\",\"name\"\r\n\"1\",\"alice\"\r\n\"2\",\"say \"\"hi\"\"\"\r\n",
+		},
+		{
+			"delimiter",
+			`{ "columns": [ "id", "note" ], "delimiter": ";" }`,
+			records,
+			"id;note\r\n1;\"a,b;c\"\r\n2;\" lead\nline\"\r\n",
+		},
+		{
+			"tab delimiter",
+			`{ "columns": [ "id", "note" ], "delimiter": "\t" }`,
+			records[:1],
+			"id\tnote\r\n1\ta,b;c\r\n",
+		},
+		{
+			"columns and paths",
+			`{ "columns": [ { "name": "Owner", "path": "owner.name" }, "id", { "name": "Tags", "path": "tags" }, "missing" ] }`,
+			records,
+			"Owner,id,Tags,missing\r\nAlice,1,,\r\n,2,\"[\"\"x\"\",\"\"y\"\"]\",\r\n",
+		},
+		{
+			"without header",
+			`{ "columns": [ "id" ], "header": false }`,
+			records,
+			"1\r\n2\r\n",
+		},
+		{
+			"header without records",
+			`{ "columns": [ "id", "name" ] }`,
+			nil,
+			"id,name\r\n",
+		},
+		{
+			"nothing without records and columns",
+			`{}`,
+			nil,
+			"",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			config := newTestCSVRender(t, test.config)
+
+			var buf strings.Builder
+			if err := config.Render(&buf, &ViewData{Records: test.records}); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != test.output {
+				t.Errorf("output = %q, want %q", buf.String(), test.output)
+			}
+		})
+	}
+}
+
+func TestCSVRenderInvalid(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{"delimiter", `{ "delimiter": ";;" }`, "Delimiter of CSV render should be a character"},
+		{"quote", `{ "quote": "none" }`, `Unknown quote "none" of CSV render`},
+		{"column", `{ "columns": [ { "path": "id" } ] }`, "Required name for column of CSV render"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			config := &CSVRenderConfig{}
+			if err := json.Unmarshal([]byte(test.config), config); err != nil {
+				t.Fatal(err)
+			}
+
+			err := config.Init()
+			if err == nil || err.Error() != test.err {
+				t.Errorf("error = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestExportResponse(t *testing.T) {
+
+	presenter := newTestPresenter(t, map[string]string{
+		"csv.json": `{
+			"method": "get",
+			"uri": "/accounts.csv",
+			"query": { "table": "accounts", "orderBy": "id" },
+			"response": {
+				"state": {
+					"success": {
+						"render": "csv",
+						"filename": "accounts 2021.csv",
+						"csv": { "columns": [ "id", { "name": "Owner", "path": "owner.name" } ] }
+					}
+				}
+			}
+		}`,
+		"ndjson.json": `{
+			"method": "get",
+			"uri": "/accounts.ndjson",
+			"query": { "table": "accounts", "orderBy": "id" },
+			"response": {
+				"state": {
+					"success": {
+						"render": "ndjson",
+						"json": {
+							"fields": [
+								{ "name": "id" },
+								{ "name": "owner", "path": "owner.name" },
+								{ "name": "type", "value": "account" }
+							],
+							"envelope": { "data": "$records" }
+						}
+					}
+				}
+			}
+		}`,
+	}, map[string]string{
+		"accounts.json": `[
+			{ "id": 1, "owner": { "name": "Alice" } },
+			{ "id": 2, "owner": { "name": "Bob, Jr." } }
+		]`,
+	})
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		disposition string
+		body        string
+	}{
+		{
+			"csv",
+			"/accounts.csv",
+			"text/csv",
+			`attachment; filename="accounts 2021.csv"`,
+			"id,Owner\r\n1,Alice\r\n2,\"Bob, Jr.\"\r\n",
+		},
+		{
+			"ndjson",
+			"/accounts.ndjson",
+			"application/x-ndjson",
+			"",
+			`{"id":1,"owner":"Alice","type":"account"}` + "\n" + `{"id":2,"owner":"Bob, Jr.","type":"account"}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			w := serveTest(presenter, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			if contentType := w.Header().Get("Content-Type"); contentType != test.contentType {
+				t.Errorf("Content-Type = %s, want %s", contentType, test.contentType)
+			}
+
+			if disposition := w.Header().Get("Content-Disposition"); disposition != test.disposition {
+				t.Errorf("Content-Disposition = %s, want %s", disposition, test.disposition)
+			}
+
+			if w.Body.String() != test.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), test.body)
+			}
+		})
+	}
+}
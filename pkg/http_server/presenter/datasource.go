@@ -0,0 +1,103 @@
+package presenter
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// DefaultDataSource is the data source configured by [querykit] section
+const DefaultDataSource = "default"
+
+// DataSources manages query backends of each data source
+type DataSources struct {
+	backends map[string]Backend
+}
+
+func NewDataSources() *DataSources {
+	return &DataSources{
+		backends: make(map[string]Backend),
+	}
+}
+
+// Init connects to default data source and data sources in [datasources.<name>] sections
+func (ds *DataSources) Init() error {
+
+	sections := map[string]string{
+		DefaultDataSource: "querykit",
+	}
+
+	for name := range viper.GetStringMap("datasources") {
+		sections[name] = "datasources." + name
+	}
+
+	for name, section := range sections {
+
+		log.WithFields(log.Fields{
+			"source":  name,
+			"backend": viper.GetString(section + ".backend"),
+			"host":    viper.GetString(section + ".host"),
+			"port":    viper.GetInt(section + ".port"),
+		}).Info("Initializing data source")
+
+		backend, err := NewBackend(viper.GetString(section + ".backend"))
+		if err != nil {
+			return err
+		}
+
+		err = backend.Init(section)
+		if err != nil {
+			return err
+		}
+
+		ds.backends[name] = backend
+	}
+
+	return nil
+}
+
+func (ds *DataSources) Initialized() bool {
+	return len(ds.backends) > 0
+}
+
+// Get returns backend of data source, default data source is used if name is empty
+func (ds *DataSources) Get(name string) (Backend, error) {
+
+	if len(name) == 0 {
+		name = DefaultDataSource
+	}
+
+	backend, ok := ds.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown data source \"%s\"", name)
+	}
+
+	return backend, nil
+}
+
+// Stats returns statistics of queries for each data source
+func (ds *DataSources) Stats() map[string]interface{} {
+
+	stats := make(map[string]interface{}, len(ds.backends))
+	for name, backend := range ds.backends {
+		stats[name] = backend.Stats()
+	}
+
+	return stats
+}
+
+// Close closes connections of all data sources
+func (ds *DataSources) Close(ctx context.Context) {
+
+	for name, backend := range ds.backends {
+
+		err := backend.Close(ctx)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"source": name,
+			}).Error(err)
+		}
+	}
+}
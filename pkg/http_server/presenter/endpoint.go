@@ -1,49 +1,50 @@
 package presenter
 
 import (
+	"context"
 	"encoding/json"
-	//"html/template"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
-	"text/template"
+	"time"
 
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+	"github.com/dop251/goja"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type ViewData struct {
-	Records []map[string]interface{}
+	Records   []map[string]interface{}
+	Errors    []*ValidationError
+	Error     *ErrorData
+	RequestID string
+
+	// Records of reply are decoded when they are needed
+	reply *querykit.QueryReply
 }
 
 type EndpointConfig struct {
 	Method   string         `json:"method"`
 	Uri      string         `json:"uri"`
+	Request  *RequestConfig `json:"request"`
 	Query    QueryConfig    `json:"query"`
 	Response ResponseConfig `json:"response"`
 }
 
 type QueryConfig struct {
-	Condition  *Condition  `json:"condition"`
-	Pagination *Pagination `json:"pagination"`
-	Table      string      `json:"table"`
-	Limit      int64       `json:"limit"`
-	Offset     int64       `json:"offset"`
-	OrderBy    string      `json:"orderBy"`
-	Descending bool        `json:"descending"`
-}
-
-type ResponseConfig struct {
-	ContentType string                     `json:"contentType"`
-	State       map[string]StateDefinition `json:"state"`
-}
-
-type StateDefinition struct {
-	ContentType string `json:"contentType"`
-	Code        int    `json:"code"`
-	Template    string `json:"template"`
-	template    *template.Template
+	Condition  *Condition   `json:"condition"`
+	Pagination *Pagination  `json:"pagination"`
+	Table      string       `json:"table"`
+	Limit      int64        `json:"limit"`
+	Offset     int64        `json:"offset"`
+	OrderBy    string       `json:"orderBy"`
+	Descending bool         `json:"descending"`
+	Cache      *CacheConfig `json:"cache"`
+	Timeout    string       `json:"timeout"`
+	Source     string       `json:"source"`
 }
 
 type VariableType int
@@ -60,17 +61,6 @@ var varTypes map[string]VariableType = map[string]VariableType{
 	"body":        VARIABLE_TYPE_BODY,
 }
 
-var defaultStates = map[string]StateDefinition{
-	"success": StateDefinition{
-		ContentType: "application/json",
-		Code:        200,
-	},
-	"no_results": StateDefinition{
-		ContentType: "application/json",
-		Code:        404,
-	},
-}
-
 type Param struct {
 	pType    VariableType
 	name     string
@@ -79,17 +69,24 @@ type Param struct {
 }
 
 type Endpoint struct {
-	presenter *Presenter
-	name      string
-	dirPath   string
-	template  *template.Template
-	method    string
-	uri       string
-	table     string
-	params    map[string]Param
-	response  *ResponseConfig
-	states    map[string]*StateDefinition
-	query     *QueryConfig
+	presenter         *Presenter
+	name              string
+	dirPath           string
+	method            string
+	uri               string
+	table             string
+	request           *RequestConfig
+	params            map[string]Param
+	response          *ResponseConfig
+	states            map[string]*StateDefinition
+	conditionalStates []string
+	global            map[string]*StateDefinition
+	funcs             map[string]interface{}
+	query             *QueryConfig
+	runtimes          *RuntimePool
+	cache             *QueryCache
+	timeout           time.Duration
+	source            Backend
 }
 
 func NewEndpoint(presenter *Presenter, name string) *Endpoint {
@@ -98,6 +95,9 @@ func NewEndpoint(presenter *Presenter, name string) *Endpoint {
 		name:      name,
 		params:    make(map[string]Param),
 		states:    make(map[string]*StateDefinition),
+		global:    make(map[string]*StateDefinition),
+		funcs:     templateFuncs(),
+		runtimes:  NewRuntimePool(),
 	}
 }
 
@@ -107,14 +107,18 @@ func (endpoint *Endpoint) loadCondition(queryConfig *QueryConfig, condition *Con
 		return nil
 	}
 
-	// Prepare value script
-	if condition.Value != nil {
-		condition.InitRuntime()
+	// Compile scripts
+	err := condition.Compile()
+	if err != nil {
+		return err
 	}
 
 	// Initializing child conditions
 	for _, c := range condition.Conditions {
-		return endpoint.loadCondition(queryConfig, c)
+		err := endpoint.loadCondition(queryConfig, c)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -126,12 +130,8 @@ func (endpoint *Endpoint) loadPagination(queryConfig *QueryConfig, pagination *P
 		return nil
 	}
 
-	// Prepare value script
-	if queryConfig.Pagination.Limit != nil || queryConfig.Pagination.Page != nil {
-		queryConfig.Pagination.InitRuntime()
-	}
-
-	return nil
+	// Compile scripts
+	return pagination.Compile()
 }
 
 func (endpoint *Endpoint) loadQuerySettings(queryConfig *QueryConfig) error {
@@ -147,6 +147,34 @@ func (endpoint *Endpoint) loadQuerySettings(queryConfig *QueryConfig) error {
 		return err
 	}
 
+	if len(queryConfig.Timeout) > 0 {
+		timeout, err := time.ParseDuration(queryConfig.Timeout)
+		if err != nil {
+			return err
+		}
+
+		endpoint.timeout = timeout
+	}
+
+	if queryConfig.Cache != nil {
+		cache, err := NewQueryCache(queryConfig.Cache)
+		if err != nil {
+			return err
+		}
+
+		endpoint.cache = cache
+	}
+
+	// Data sources are not connected for exporting API documentation
+	if endpoint.presenter.dataSources.Initialized() {
+		source, err := endpoint.presenter.dataSources.Get(queryConfig.Source)
+		if err != nil {
+			return err
+		}
+
+		endpoint.source = source
+	}
+
 	return nil
 
 }
@@ -175,8 +203,17 @@ func (endpoint *Endpoint) Load(filename string) error {
 	endpoint.method = config.Method
 	endpoint.uri = config.Uri
 	endpoint.table = config.Query.Table
+	endpoint.request = config.Request
 	endpoint.response = &config.Response
 
+	// Initialize request validation
+	if endpoint.request != nil {
+		err = endpoint.request.Init()
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(endpoint.response.ContentType) == 0 {
 		endpoint.response.ContentType = "application/json"
 	}
@@ -203,74 +240,26 @@ func (endpoint *Endpoint) Load(filename string) error {
 	return nil
 }
 
-func (endpoint *Endpoint) InitStates() error {
-
-	for stateName, defState := range defaultStates {
-
-		state, ok := endpoint.response.State[stateName]
-		if !ok {
-			if s, ok := endpoint.response.State["success"]; ok {
-				state = s
-			} else {
-				state = defState
-			}
-		} else {
-
-			if state.Code == 0 {
-				state.Code = 200
-			}
-
-			if len(state.ContentType) == 0 {
-				state.ContentType = "application/json"
-			}
-		}
-
-		tpName := ""
-		if len(state.Template) == 0 {
-			tpName = endpoint.name + ".tmpl"
-			state.Template = filepath.Join(endpoint.dirPath, endpoint.name+".tmpl")
-		} else if string(state.Template[0]) != "/" {
-			tpName = state.Template
-			state.Template = filepath.Join(endpoint.dirPath, state.Template)
-		}
-
-		// Load template
-		tf := template.FuncMap{
-			"counter": func(i int) int {
-				return i + 1
-			},
-		}
-
-		t, err := template.New(tpName).Funcs(tf).ParseFiles(state.Template)
-		if err != nil {
-			return err
-		}
-
-		state.template = t
-
-		endpoint.states[stateName] = &state
-	}
-
-	return nil
-}
-
-func (endpoint *Endpoint) Register() error {
+func (endpoint *Endpoint) Register(engine *gin.Engine) error {
 
 	switch endpoint.method {
 	case "post":
-		endpoint.presenter.server.GetEngine().POST(endpoint.uri, endpoint.handler)
+		engine.POST(endpoint.uri, endpoint.handler)
 	case "get":
-		endpoint.presenter.server.GetEngine().GET(endpoint.uri, endpoint.handler)
+		engine.GET(endpoint.uri, endpoint.handler)
+
+		// HEAD is handled as GET, and body is discarded by HTTP server
+		engine.HEAD(endpoint.uri, endpoint.handler)
 	case "delete":
-		endpoint.presenter.server.GetEngine().DELETE(endpoint.uri, endpoint.handler)
+		engine.DELETE(endpoint.uri, endpoint.handler)
 	case "put":
-		endpoint.presenter.server.GetEngine().PUT(endpoint.uri, endpoint.handler)
+		engine.PUT(endpoint.uri, endpoint.handler)
 	}
 
 	return nil
 }
 
-func (endpoint *Endpoint) prepareCondition(ctx *gin.Context, c *Condition) (*Condition, error) {
+func (endpoint *Endpoint) prepareCondition(runtime *goja.Runtime, c *Condition) (*Condition, error) {
 
 	if c == nil {
 		if endpoint.query.Condition == nil {
@@ -284,40 +273,13 @@ func (endpoint *Endpoint) prepareCondition(ctx *gin.Context, c *Condition) (*Con
 	condition := &Condition{
 		Name:       c.Name,
 		Operator:   c.Operator,
+		Value:      c.Value,
 		Conditions: make([]*Condition, 0, len(c.Conditions)),
 	}
 
-	condition.InitRuntime()
-
-	// Prepare environment variable for script
-	querys := make(map[string]string, len(ctx.Request.URL.Query()))
-	for k, v := range ctx.Request.URL.Query() {
-		querys[k] = v[0]
-	}
-	//condition.Runtime.Set("query", ctx.Request.URL.Query())
-	condition.Runtime.Set("query", querys)
-
-	// Path parameters
-	params := make(map[string]interface{}, len(ctx.Params))
-	//	params := condition.Runtime.NewObject()
-	for _, p := range ctx.Params {
-		//		params.Set(p.Key, p.Value)
-		params[p.Key] = p.Value
-	}
-
-	//condition.Runtime.Set("param", mapper.NewParamObject(params))
-	condition.Runtime.Set("param", params)
-
-	// Body
-	var body map[string]interface{}
-	err := ctx.ShouldBind(&body)
-	if err != nil {
-		return nil, err
-	}
-
 	// Run script to get result
-	if c.Value != nil {
-		result, err := condition.Runtime.RunString(c.Value.(string))
+	if c.valueProgram != nil {
+		result, err := runtime.RunProgram(c.valueProgram)
 		if err != nil {
 			return nil, err
 		}
@@ -325,18 +287,23 @@ func (endpoint *Endpoint) prepareCondition(ctx *gin.Context, c *Condition) (*Con
 		condition.Value = result.Export()
 	}
 
-	if c.Field != "" {
-		result, err := condition.Runtime.RunString(c.Field)
+	// Optional condition without value is true, so it is removed from group
+	if c.Optional && len(c.Conditions) == 0 && isAbsentValue(condition.Value) {
+		return alwaysTrue(), nil
+	}
+
+	if c.fieldProgram != nil {
+		result, err := runtime.RunProgram(c.fieldProgram)
 		if err != nil {
 			return nil, err
 		} else {
-			condition.Name = result.Export().(string)
+			condition.Name = result.String()
 		}
 	}
 
 	// Processing childs
 	for _, child := range c.Conditions {
-		sub, err := endpoint.prepareCondition(ctx, child)
+		sub, err := endpoint.prepareCondition(runtime, child)
 		if err != nil {
 			return nil, err
 		}
@@ -344,10 +311,15 @@ func (endpoint *Endpoint) prepareCondition(ctx *gin.Context, c *Condition) (*Con
 		condition.Conditions = append(condition.Conditions, sub)
 	}
 
-	return condition, nil
+	if len(c.Conditions) == 0 {
+		return condition, nil
+	}
+
+	// "&&" group of removed conditions is true, and "||" group with any of them is true
+	return simplifyCondition(condition), nil
 }
 
-func (endpoint *Endpoint) preparePagination(ctx *gin.Context, p *Pagination) (*Pagination, error) {
+func (endpoint *Endpoint) preparePagination(runtime *goja.Runtime, p *Pagination) (*Pagination, error) {
 
 	if p == nil {
 		if endpoint.query.Pagination == nil {
@@ -363,33 +335,16 @@ func (endpoint *Endpoint) preparePagination(ctx *gin.Context, p *Pagination) (*P
 		Page:  p.Page,
 	}
 
-	pagination.InitRuntime()
-
-	// Prepare environment variable for script
-	querys := make(map[string]string, len(ctx.Request.URL.Query()))
-	for k, v := range ctx.Request.URL.Query() {
-		querys[k] = v[0]
-	}
-	pagination.Runtime.Set("query", querys)
-
-	// Path parameters
-	params := make(map[string]interface{}, len(ctx.Params))
-	for _, p := range ctx.Params {
-		params[p.Key] = p.Value
-	}
-
-	pagination.Runtime.Set("param", params)
-
-	if p.Limit != nil {
-		result, err := pagination.Runtime.RunString(p.Limit.(string))
+	if p.limitProgram != nil {
+		result, err := runtime.RunProgram(p.limitProgram)
 		if err != nil {
 			return nil, err
 		} else {
 			pagination.Limit = result.Export()
 		}
 	}
-	if p.Page != nil {
-		result, err := pagination.Runtime.RunString(p.Page.(string))
+	if p.pageProgram != nil {
+		result, err := runtime.RunProgram(p.pageProgram)
 		if err != nil {
 			return nil, err
 		} else {
@@ -402,20 +357,49 @@ func (endpoint *Endpoint) preparePagination(ctx *gin.Context, p *Pagination) (*P
 
 func (endpoint *Endpoint) handler(c *gin.Context) {
 
-	condition, err := endpoint.prepareCondition(c, nil)
+	// Parse request once for all scripts
+	rc, err := NewRequestContext(c)
+	c.Header(RequestIDHeader, rc.RequestID)
 	if err != nil {
-		log.Error(err)
-		c.Status(http.StatusBadRequest)
-		c.Abort()
+		endpoint.renderError(c, rc, nil, NewStateError("bad_request", "request", err))
+		return
+	}
+
+	// Validate request before running scripts
+	if endpoint.request != nil {
+		errs := endpoint.request.Validate(rc)
+		if len(errs) > 0 {
+			endpoint.renderError(c, rc, nil, &StateError{
+				State:   "bad_request",
+				Kind:    "validation",
+				Message: "Invalid request",
+				Errors:  errs,
+			})
+			return
+		}
+	}
+
+	// Scripts of endpoint share the same runtime
+	runtime := endpoint.runtimes.Get()
+	defer endpoint.runtimes.Put(runtime)
+
+	rc.Apply(runtime)
+
+	condition, err := endpoint.prepareCondition(runtime, nil)
+	if err != nil {
+		endpoint.renderError(c, rc, runtime, scriptError("bad_request", "script", err))
 		return
 	}
 
+	// All of optional conditions are absent, records of the whole table are queried
+	if condition != nil && isConstant(condition, "&&") {
+		condition = nil
+	}
+
 	// process pagination
-	pagination, err := endpoint.preparePagination(c, nil)
+	pagination, err := endpoint.preparePagination(runtime, nil)
 	if err != nil {
-		log.Error(err)
-		c.Status(http.StatusBadRequest)
-		c.Abort()
+		endpoint.renderError(c, rc, runtime, scriptError("bad_request", "script", err))
 		return
 	}
 
@@ -444,42 +428,157 @@ func (endpoint *Endpoint) handler(c *gin.Context) {
 		Descending: endpoint.query.Descending,
 	}
 
-	result, err := endpoint.presenter.queryAdapter.Query(endpoint.table, condition, &queryOption)
+	// Query is canceled if client is gone or it takes too long
+	ctx := c.Request.Context()
+	if timeout := endpoint.getTimeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	result, err := endpoint.queryRecords(ctx, condition, &queryOption)
 	if err != nil {
-		log.Error(err)
-		c.Status(http.StatusInternalServerError)
-		c.Abort()
+		endpoint.queryFailed(c, rc, runtime, err)
 		return
 	}
 
 	data := ViewData{
-		Records: make([]map[string]interface{}, 0, len(result.Records)),
+		RequestID: rc.RequestID,
+		reply:     result,
 	}
 
+	stateName := "success"
 	if len(result.Records) == 0 {
+		stateName = "no_results"
+	}
 
-		// Render for no results
-		state := endpoint.states["no_results"]
-		c.Writer.Header().Set("Content-Type", state.ContentType)
-		c.Status(state.Code)
-		state.template.Execute(c.Writer, data)
+	// Conditions of states decide response
+	selected, err := endpoint.selectState(runtime, &data)
+	if err != nil {
+		endpoint.renderError(c, rc, runtime, scriptError("error", "script", err))
 		return
 	}
 
-	// Prepare records
-	for _, record := range result.Records {
+	if len(selected) > 0 {
+		stateName = selected
+	}
 
-		row := make(map[string]interface{})
+	// Render
+	endpoint.render(c, rc, runtime, stateName, &data)
+}
+
+// getTimeout returns timeout of query, default timeout is used if endpoint has no timeout
+func (endpoint *Endpoint) getTimeout() time.Duration {
+
+	if endpoint.timeout > 0 {
+		return endpoint.timeout
+	}
+
+	return endpoint.source.Timeout()
+}
+
+// queryFailed responds with specific state for timeout and unavailable querykit
+func (endpoint *Endpoint) queryFailed(c *gin.Context, rc *RequestContext, runtime *goja.Runtime, err error) {
+
+	// Nobody is waiting for response
+	if c.Request.Context().Err() != nil {
+		log.WithFields(log.Fields{
+			"endpoint":  endpoint.name,
+			"requestID": rc.RequestID,
+		}).Warn("Client is gone before query is completed")
+		c.Abort()
+		return
+	}
+
+	if err == context.DeadlineExceeded || status.Code(err) == codes.DeadlineExceeded {
+		endpoint.renderError(c, rc, runtime, NewStateError("timeout", "timeout", err))
+		return
+	}
+
+	// Conditions evaluated by presenter match too many records
+	if err == ErrScanLimitExceeded {
+		endpoint.renderError(c, rc, runtime, NewStateError("error", "query", err))
+		return
+	}
+
+	// Querykit is not available now
+	if err == ErrCircuitOpen || status.Code(err) == codes.Unavailable {
+		endpoint.renderError(c, rc, runtime, NewStateError("service_unavailable", "unavailable", err))
+		return
+	}
 
-		for _, field := range record.Fields {
-			row[field.Name] = GetValue(field.Value)
+	endpoint.renderError(c, rc, runtime, NewStateError("error", "query", err))
+}
+
+// queryRecords queries with cache if it is enabled
+func (endpoint *Endpoint) queryRecords(ctx context.Context, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+
+	if endpoint.cache == nil {
+		return endpoint.source.Query(ctx, endpoint.table, condition, option)
+	}
+
+	key, err := queryKey(endpoint.table, condition, option)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply, ok := endpoint.cache.Get(key); ok {
+		return reply, nil
+	}
+
+	reply, err := endpoint.source.Query(ctx, endpoint.table, condition, option)
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Success {
+		endpoint.cache.Set(key, reply)
+	}
+
+	return reply, nil
+}
+
+func decodeRecord(record *querykit.Record) map[string]interface{} {
+
+	row := make(map[string]interface{}, len(record.Fields))
+	for _, field := range record.Fields {
+		row[field.Name] = DecodeValue(field.Value)
+	}
+
+	return row
+}
+
+// loadRecords decodes all records of reply for templates and scripts
+func (data *ViewData) loadRecords() {
+
+	if data.Records != nil || data.reply == nil {
+		return
+	}
+
+	data.Records = make([]map[string]interface{}, 0, len(data.reply.Records))
+	for _, record := range data.reply.Records {
+		data.Records = append(data.Records, decodeRecord(record))
+	}
+}
+
+// eachRecord iterates records, they are decoded one by one if they were not decoded yet
+func (data *ViewData) eachRecord(fn func(map[string]interface{}) error) error {
+
+	if data.Records != nil || data.reply == nil {
+		for _, record := range data.Records {
+			if err := fn(record); err != nil {
+				return err
+			}
 		}
 
-		data.Records = append(data.Records, row)
+		return nil
 	}
 
-	// Render
-	state := endpoint.states["success"]
-	c.Writer.Header().Set("Content-Type", state.ContentType)
-	state.template.Execute(c.Writer, data)
+	for _, record := range data.reply.Records {
+		if err := fn(decodeRecord(record)); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,127 @@
+package presenter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func compileTestCondition(t *testing.T, source string) *Condition {
+
+	condition := NewCondition()
+	if err := json.Unmarshal([]byte(source), condition); err != nil {
+		t.Fatal(err)
+	}
+
+	var compile func(c *Condition)
+	compile = func(c *Condition) {
+
+		if err := c.Compile(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, child := range c.Conditions {
+			compile(child)
+		}
+	}
+
+	compile(condition)
+
+	return condition
+}
+
+func TestPrepareOptionalCondition(t *testing.T) {
+
+	source := `{
+		"operator": "||",
+		"conditions": [
+			{ "name": "id", "operator": "=", "value": "query.id", "optional": true },
+			{
+				"operator": "&&",
+				"conditions": [
+					{ "name": "name", "operator": "=", "value": "query.name", "optional": true },
+					{ "name": "type", "operator": "=", "value": "query.type", "optional": true }
+				]
+			}
+		]
+	}`
+
+	records := []map[string]interface{}{
+		{"id": int64(1), "name": "alice", "type": "a"},
+		{"id": int64(2), "name": "bob", "type": "b"},
+		{"id": int64(3), "name": "bob", "type": "a"},
+	}
+
+	tests := []struct {
+		name  string
+		query map[string]interface{}
+		ids   []int64
+		empty bool
+	}{
+		{"all present", map[string]interface{}{"id": int64(1), "name": "bob", "type": "b"}, []int64{1, 2}, false},
+		{"partial group", map[string]interface{}{"id": int64(1), "name": "bob"}, []int64{1, 2, 3}, false},
+		{"group absent", map[string]interface{}{"id": int64(1)}, []int64{1, 2, 3}, true},
+		{"id absent", map[string]interface{}{"name": "bob", "type": "a"}, []int64{1, 2, 3}, true},
+		{"all absent", map[string]interface{}{"id": "", "name": nil}, []int64{1, 2, 3}, true},
+	}
+
+	endpoint := &Endpoint{}
+	condition := compileTestCondition(t, source)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			runtime := newRuntime()
+			runtime.Set("query", test.query)
+
+			prepared, err := endpoint.prepareCondition(runtime, condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if isConstant(prepared, "&&") != test.empty {
+				t.Errorf("condition is always true = %v, want %v", !test.empty, test.empty)
+			}
+
+			ids := make([]int64, 0)
+			for _, record := range records {
+				if matchCondition(record, prepared) {
+					ids = append(ids, record["id"].(int64))
+				}
+			}
+
+			if len(ids) != len(test.ids) {
+				t.Fatalf("matched %v, want %v", ids, test.ids)
+			}
+
+			for i := range ids {
+				if ids[i] != test.ids[i] {
+					t.Fatalf("matched %v, want %v", ids, test.ids)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareOptionalConditionInAndGroup(t *testing.T) {
+
+	source := `{
+		"operator": "&&",
+		"conditions": [
+			{ "name": "type", "operator": "=", "value": "'a'" },
+			{ "name": "name", "operator": "=", "value": "query.name", "optional": true }
+		]
+	}`
+
+	runtime := newRuntime()
+	runtime.Set("query", map[string]interface{}{})
+
+	prepared, err := (&Endpoint{}).prepareCondition(runtime, compileTestCondition(t, source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Group of single condition is the condition
+	if prepared.Name != "type" || prepared.Value != "a" {
+		t.Errorf("condition = %+v, want type = a", prepared)
+	}
+}
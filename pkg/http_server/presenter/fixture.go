@@ -0,0 +1,349 @@
+package presenter
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+)
+
+// FixtureBackend serves tables which are loaded from JSON and CSV files in memory
+type FixtureBackend struct {
+	path     string
+	timeout  time.Duration
+	tables   map[string][]map[string]interface{}
+	requests uint64
+}
+
+type FixtureStats struct {
+	Requests uint64         `json:"requests"`
+	Tables   map[string]int `json:"tables"`
+}
+
+func NewFixtureBackend() *FixtureBackend {
+	return &FixtureBackend{
+		tables: make(map[string][]map[string]interface{}),
+	}
+}
+
+// Init loads fixtures in directory of data source, the name of file is the table name
+func (backend *FixtureBackend) Init(section string) error {
+
+	backend.path = viper.GetString(section + ".fixtures")
+	backend.timeout = viper.GetDuration(section + ".timeout")
+
+	if len(backend.path) == 0 {
+		return errors.New("Required path of fixtures")
+	}
+
+	files, err := ioutil.ReadDir(backend.path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+
+		if file.IsDir() {
+			continue
+		}
+
+		filename := filepath.Join(backend.path, file.Name())
+		ext := filepath.Ext(file.Name())
+		table := strings.TrimSuffix(file.Name(), ext)
+
+		var records []map[string]interface{}
+		switch strings.ToLower(ext) {
+		case ".json":
+			records, err = loadJSONFixture(filename)
+		case ".csv":
+			records, err = loadCSVFixture(filename)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("Failed to load fixture \"%s\": %v", filename, err)
+		}
+
+		log.WithFields(log.Fields{
+			"table":   table,
+			"records": len(records),
+		}).Info("Loaded fixture")
+
+		backend.tables[table] = records
+	}
+
+	return nil
+}
+
+func loadJSONFixture(filename string) ([]map[string]interface{}, error) {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var records []map[string]interface{}
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	err = decoder.Decode(&records)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		for name, value := range record {
+			record[name] = normalizeJSONValue(value)
+		}
+	}
+
+	return records, nil
+}
+
+// normalizeJSONValue converts numbers to int64 or float64 which are returned by querykit
+func normalizeJSONValue(value interface{}) interface{} {
+
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, ele := range v {
+			v[key] = normalizeJSONValue(ele)
+		}
+	case []interface{}:
+		for i, ele := range v {
+			v[i] = normalizeJSONValue(ele)
+		}
+	}
+
+	return value
+}
+
+// loadCSVFixture loads records with header, cells are strings unless types of columns are declared
+// in header like "id:int", and empty cells are null
+func loadCSVFixture(filename string) ([]map[string]interface{}, error) {
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return make([]map[string]interface{}, 0), nil
+	}
+
+	names := make([]string, 0, len(rows[0]))
+	types := make([]string, 0, len(rows[0]))
+	for _, column := range rows[0] {
+
+		name := column
+		dataType := "string"
+		if i := strings.LastIndex(column, ":"); i >= 0 {
+			name = column[:i]
+			dataType = column[i+1:]
+		}
+
+		switch dataType {
+		case "string", "int", "uint", "float", "bool":
+		default:
+			return nil, fmt.Errorf("Unknown type \"%s\" of column \"%s\"", dataType, name)
+		}
+
+		names = append(names, name)
+		types = append(types, dataType)
+	}
+
+	records := make([]map[string]interface{}, 0, len(rows)-1)
+	for line, row := range rows[1:] {
+
+		record := make(map[string]interface{}, len(names))
+		for i, name := range names {
+
+			value, err := parseCSVValue(row[i], types[i])
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value of column \"%s\" at line %d: %v", name, line+2, err)
+			}
+
+			record[name] = value
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func parseCSVValue(cell string, dataType string) (interface{}, error) {
+
+	if len(cell) == 0 {
+		return nil, nil
+	}
+
+	switch dataType {
+	case "int":
+		return strconv.ParseInt(cell, 10, 64)
+	case "uint":
+		return strconv.ParseUint(cell, 10, 64)
+	case "float":
+		return strconv.ParseFloat(cell, 64)
+	case "bool":
+		return strconv.ParseBool(cell)
+	}
+
+	return cell, nil
+}
+
+// Query filters, orders and paginates records of table like querykit does
+func (backend *FixtureBackend) Query(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+
+	atomic.AddUint64(&backend.requests, 1)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	records, ok := backend.tables[table]
+	if !ok {
+		return nil, fmt.Errorf("Unknown table \"%s\"", table)
+	}
+
+	expanded, err := expandCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := make([]map[string]interface{}, 0)
+	for _, record := range records {
+		if matchCondition(record, expanded) {
+			matched = append(matched, record)
+		}
+	}
+
+	if len(option.OrderBy) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			a := getValueFromObject(matched[i], option.OrderBy)
+			b := getValueFromObject(matched[j], option.OrderBy)
+			if option.Descending {
+				a, b = b, a
+			}
+
+			return lessValue(a, b)
+		})
+	}
+
+	start, end := pageRange(len(matched), option)
+	matched = matched[start:end]
+
+	reply := &querykit.QueryReply{
+		Success: true,
+		Records: make([]*querykit.Record, 0, len(matched)),
+	}
+
+	for _, record := range matched {
+		r, err := encodeRecord(record)
+		if err != nil {
+			return nil, err
+		}
+
+		reply.Records = append(reply.Records, r)
+	}
+
+	return reply, nil
+}
+
+// pageRange returns range of records for offset and limit of query
+func pageRange(count int, option *QueryOption) (int, int) {
+
+	start := 0
+	if option.Offset > 0 {
+		start = count
+		if option.Offset < int64(count) {
+			start = int(option.Offset)
+		}
+	}
+
+	end := count
+	if option.Limit > 0 && option.Limit < int64(end-start) {
+		end = start + int(option.Limit)
+	}
+
+	return start, end
+}
+
+func encodeRecord(record map[string]interface{}) (*querykit.Record, error) {
+
+	names := make([]string, 0, len(record))
+	for name := range record {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	r := &querykit.Record{
+		Fields: make([]*querykit.Field, 0, len(names)),
+	}
+
+	for _, name := range names {
+		v, err := EncodeValue(record[name])
+		if err != nil {
+			return nil, err
+		}
+
+		r.Fields = append(r.Fields, &querykit.Field{
+			Name:  name,
+			Value: v,
+		})
+	}
+
+	return r, nil
+}
+
+func (backend *FixtureBackend) Timeout() time.Duration {
+	return backend.timeout
+}
+
+func (backend *FixtureBackend) Stats() interface{} {
+
+	stats := &FixtureStats{
+		Requests: atomic.LoadUint64(&backend.requests),
+		Tables:   make(map[string]int, len(backend.tables)),
+	}
+
+	for table, records := range backend.tables {
+		stats.Tables[table] = len(records)
+	}
+
+	return stats
+}
+
+func (backend *FixtureBackend) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,237 @@
+package presenter
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const accountsFixture = `[
+	{ "id": 1, "name": "alice", "balance": 10.5, "active": true, "tags": [ "vip", "new" ] },
+	{ "id": 2, "name": "bob", "balance": 3, "active": false, "tags": [] },
+	{ "id": 3, "name": "carol", "balance": 25, "active": true, "tags": [ "vip" ] },
+	{ "id": 4, "name": "dave", "active": false }
+]`
+
+const phonesFixture = `id:int,phone,score:float,verified:bool,note
+1,0912345678,1.5,true,
+2,0987654321,,false,hello
+`
+
+func newTestFixtureBackend(t *testing.T, files map[string]string) *FixtureBackend {
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	section := "fixture_" + strings.Replace(t.Name(), "/", "_", -1)
+	viper.Set(section+".fixtures", dir)
+
+	backend := NewFixtureBackend()
+	if err := backend.Init(section); err != nil {
+		t.Fatal(err)
+	}
+
+	return backend
+}
+
+func queryFixtureIDs(t *testing.T, backend *FixtureBackend, table string, condition *Condition, option *QueryOption) string {
+
+	reply, err := backend.Query(context.Background(), table, condition, option)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, 0, len(reply.Records))
+	for _, record := range reply.Records {
+		ids = append(ids, fmt.Sprint(decodeRecord(record)["id"]))
+	}
+
+	return strings.Join(ids, ",")
+}
+
+func TestFixtureOperators(t *testing.T) {
+
+	backend := newTestFixtureBackend(t, map[string]string{
+		"accounts.json": accountsFixture,
+	})
+
+	tests := []struct {
+		name      string
+		condition *Condition
+		ids       string
+	}{
+		{"no condition", nil, "1,2,3,4"},
+		{"empty operator", &Condition{Name: "name", Value: "bob"}, "2"},
+		{"=", &Condition{Name: "id", Operator: "=", Value: int64(3)}, "3"},
+		{"== float", &Condition{Name: "balance", Operator: "==", Value: 3.0}, "2"},
+		{"!=", &Condition{Name: "active", Operator: "!=", Value: true}, "2,4"},
+		{">", &Condition{Name: "balance", Operator: ">", Value: int64(10)}, "1,3"},
+		{">=", &Condition{Name: "balance", Operator: ">=", Value: 10.5}, "1,3"},
+		{"<", &Condition{Name: "name", Operator: "<", Value: "carol"}, "1,2"},
+		{"<=", &Condition{Name: "id", Operator: "<=", Value: int64(2)}, "1,2"},
+		{"compare null", &Condition{Name: "balance", Operator: "<", Value: int64(100)}, "1,2,3"},
+		{"isExist", &Condition{Name: "balance", Operator: "isExist"}, "1,2,3"},
+		{"isExist false", &Condition{Name: "balance", Operator: "isExist", Value: false}, "4"},
+		{"in", &Condition{Name: "id", Operator: "in", Value: []interface{}{int64(1), int64(4)}}, "1,4"},
+		{"in empty", &Condition{Name: "id", Operator: "in", Value: []interface{}{}}, ""},
+		{"notIn", &Condition{Name: "id", Operator: "notIn", Value: []interface{}{int64(1), int64(4)}}, "2,3"},
+		{"between", &Condition{Name: "balance", Operator: "between", Value: []interface{}{int64(3), 10.0}}, "2"},
+		{"startsWith", &Condition{Name: "name", Operator: "startsWith", Value: "ca"}, "3"},
+		{"contains string", &Condition{Name: "name", Operator: "contains", Value: "o"}, "2,3"},
+		{"contains element", &Condition{Name: "tags", Operator: "contains", Value: "vip"}, "1,3"},
+		{
+			"&&",
+			&Condition{Operator: "&&", Conditions: []*Condition{
+				{Name: "active", Value: true},
+				{Name: "balance", Operator: ">", Value: int64(20)},
+			}},
+			"3",
+		},
+		{
+			"||",
+			&Condition{Operator: "||", Conditions: []*Condition{
+				{Name: "id", Value: int64(1)},
+				{Name: "name", Value: "dave"},
+			}},
+			"1,4",
+		},
+		{"always true", alwaysTrue(), "1,2,3,4"},
+		{"always false", alwaysFalse(), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			ids := queryFixtureIDs(t, backend, "accounts", test.condition, &QueryOption{})
+			if ids != test.ids {
+				t.Errorf("ids = [%s], want [%s]", ids, test.ids)
+			}
+		})
+	}
+}
+
+func TestFixtureOrderAndPagination(t *testing.T) {
+
+	backend := newTestFixtureBackend(t, map[string]string{
+		"accounts.json": accountsFixture,
+	})
+
+	tests := []struct {
+		name   string
+		option *QueryOption
+		ids    string
+	}{
+		{"order by", &QueryOption{OrderBy: "balance"}, "4,2,1,3"},
+		{"descending", &QueryOption{OrderBy: "balance", Descending: true}, "3,1,2,4"},
+		{"order by string", &QueryOption{OrderBy: "name", Descending: true}, "4,3,2,1"},
+		{"limit", &QueryOption{Limit: 2}, "1,2"},
+		{"offset", &QueryOption{Offset: 3}, "4"},
+		{"limit and offset", &QueryOption{OrderBy: "id", Descending: true, Limit: 2, Offset: 1}, "3,2"},
+		{"offset out of range", &QueryOption{Offset: 10, Limit: 2}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			ids := queryFixtureIDs(t, backend, "accounts", nil, test.option)
+			if ids != test.ids {
+				t.Errorf("ids = [%s], want [%s]", ids, test.ids)
+			}
+		})
+	}
+}
+
+func TestFixtureUnknownTable(t *testing.T) {
+
+	backend := newTestFixtureBackend(t, map[string]string{
+		"accounts.json": accountsFixture,
+	})
+
+	_, err := backend.Query(context.Background(), "missing", nil, &QueryOption{})
+	if err == nil || err.Error() != `Unknown table "missing"` {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestFixtureCSV(t *testing.T) {
+
+	backend := newTestFixtureBackend(t, map[string]string{
+		"phones.csv": phonesFixture,
+	})
+
+	reply, err := backend.Query(context.Background(), "phones", &Condition{Name: "phone", Value: "0912345678"}, &QueryOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reply.Records) != 1 {
+		t.Fatalf("records = %d, want 1", len(reply.Records))
+	}
+
+	// Cells are strings unless types are declared, and empty cells are null
+	record := decodeRecord(reply.Records[0])
+	want := map[string]interface{}{
+		"id":       int64(1),
+		"phone":    "0912345678",
+		"score":    1.5,
+		"verified": true,
+		"note":     nil,
+	}
+
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("record = %#v, want %#v", record, want)
+	}
+}
+
+func TestFixtureCSVInvalid(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"unknown type", "id:integer\n1\n", `Unknown type "integer" of column "id"`},
+		{"invalid value", "id:int\n1\nx\n", `Invalid value of column "id" at line 3`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			dir, err := ioutil.TempDir("", "fixtures")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer os.RemoveAll(dir)
+
+			filename := filepath.Join(dir, "table.csv")
+			if err := ioutil.WriteFile(filename, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = loadCSVFixture(filename)
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("error = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package presenter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrFlightInterrupted = errors.New("Call was interrupted")
+
+// FlightGroup deduplicates identical calls in progress
+type FlightGroup struct {
+	requests  uint64
+	calls     uint64
+	coalesced uint64
+
+	flights map[string]*flight
+	mutex   sync.Mutex
+}
+
+type flight struct {
+	done   chan struct{}
+	reply  *querykit.QueryReply
+	err    error
+	refs   int
+	cancel context.CancelFunc
+
+	// Call is canceled by timer at the latest deadline of callers, no timer means no deadline
+	deadline time.Time
+	timer    *time.Timer
+	expired  bool
+}
+
+type FlightStats struct {
+	Requests  uint64 `json:"requests"`
+	Calls     uint64 `json:"calls"`
+	Coalesced uint64 `json:"coalesced"`
+	InFlight  int    `json:"inFlight"`
+}
+
+func NewFlightGroup() *FlightGroup {
+	return &FlightGroup{
+		flights: make(map[string]*flight),
+	}
+}
+
+// Do executes fn once for callers with the same key at the same time, all of them get the same reply.
+// Call has the latest deadline of callers, and it is canceled only if all callers are gone.
+func (group *FlightGroup) Do(ctx context.Context, key string, fn func(context.Context) (*querykit.QueryReply, error)) (*querykit.QueryReply, error) {
+
+	atomic.AddUint64(&group.requests, 1)
+
+	group.mutex.Lock()
+	if f, ok := group.flights[key]; ok {
+		f.refs++
+		group.extendLocked(f, ctx)
+		group.mutex.Unlock()
+		atomic.AddUint64(&group.coalesced, 1)
+
+		return group.wait(ctx, key, f)
+	}
+
+	// Call is not canceled by the first caller, deadline is extended by callers coming later
+	flightCtx, cancel := context.WithCancel(context.Background())
+
+	f := &flight{
+		done:   make(chan struct{}),
+		err:    ErrFlightInterrupted,
+		refs:   1,
+		cancel: cancel,
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		f.deadline = deadline
+		f.timer = time.AfterFunc(time.Until(deadline), func() {
+			group.expire(key, f)
+		})
+	}
+
+	group.flights[key] = f
+	group.mutex.Unlock()
+
+	atomic.AddUint64(&group.calls, 1)
+
+	go func() {
+
+		// Waiting callers are released even if fn panics
+		defer func() {
+			if r := recover(); r != nil {
+				log.WithFields(log.Fields{
+					"key": key,
+				}).Error(r)
+			}
+
+			group.mutex.Lock()
+			if group.flights[key] == f {
+				delete(group.flights, key)
+			}
+
+			if f.timer != nil {
+				f.timer.Stop()
+			}
+
+			// Call was canceled because deadline is reached
+			if f.expired && f.err != nil {
+				f.err = context.DeadlineExceeded
+			}
+			group.mutex.Unlock()
+
+			cancel()
+			close(f.done)
+		}()
+
+		f.reply, f.err = fn(flightCtx)
+	}()
+
+	return group.wait(ctx, key, f)
+}
+
+// extendLocked extends deadline of call for caller which has more time
+func (group *FlightGroup) extendLocked(f *flight, ctx context.Context) {
+
+	if f.timer == nil {
+		return
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		f.timer.Stop()
+		f.timer = nil
+		return
+	}
+
+	if deadline.After(f.deadline) {
+		f.deadline = deadline
+		f.timer.Reset(time.Until(deadline))
+	}
+}
+
+// expire cancels call once the latest deadline is reached
+func (group *FlightGroup) expire(key string, f *flight) {
+
+	group.mutex.Lock()
+
+	// Deadline was extended or removed
+	if f.timer == nil || time.Now().Before(f.deadline) {
+		group.mutex.Unlock()
+		return
+	}
+
+	// Callers coming later don't join the expired call
+	f.expired = true
+	if group.flights[key] == f {
+		delete(group.flights, key)
+	}
+
+	group.mutex.Unlock()
+
+	f.cancel()
+}
+
+func (group *FlightGroup) wait(ctx context.Context, key string, f *flight) (*querykit.QueryReply, error) {
+
+	select {
+	case <-f.done:
+		return f.reply, f.err
+	case <-ctx.Done():
+	}
+
+	// The last caller cancels the call
+	group.mutex.Lock()
+	f.refs--
+	if f.refs == 0 {
+		f.cancel()
+		if group.flights[key] == f {
+			delete(group.flights, key)
+		}
+	}
+	group.mutex.Unlock()
+
+	return nil, ctx.Err()
+}
+
+func (group *FlightGroup) Stats() *FlightStats {
+
+	group.mutex.Lock()
+	inFlight := len(group.flights)
+	group.mutex.Unlock()
+
+	return &FlightStats{
+		Requests:  atomic.LoadUint64(&group.requests),
+		Calls:     atomic.LoadUint64(&group.calls),
+		Coalesced: atomic.LoadUint64(&group.coalesced),
+		InFlight:  inFlight,
+	}
+}
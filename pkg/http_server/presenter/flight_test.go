@@ -0,0 +1,267 @@
+package presenter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+)
+
+func TestFlightKeepsDeadline(t *testing.T) {
+
+	group := NewFlightGroup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	finished := make(chan error, 1)
+	_, err := group.Do(ctx, "key", func(ctx context.Context) (*querykit.QueryReply, error) {
+		<-ctx.Done()
+		finished <- ctx.Err()
+		return nil, ctx.Err()
+	})
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Call doesn't run after deadline
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("call is not canceled at deadline")
+	}
+}
+
+func TestFlightExtendsDeadline(t *testing.T) {
+
+	group := NewFlightGroup()
+
+	started := make(chan struct{})
+	fn := func(ctx context.Context) (*querykit.QueryReply, error) {
+		close(started)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+			return &querykit.QueryReply{}, nil
+		}
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancelShort()
+
+	shortErr := make(chan error, 1)
+	go func() {
+		_, err := group.Do(short, "key", fn)
+		shortErr <- err
+	}()
+
+	<-started
+
+	// Caller with more time joins the call which is started by the short one
+	long, cancelLong := context.WithTimeout(context.Background(), time.Second)
+	defer cancelLong()
+
+	reply, err := group.Do(long, "key", fn)
+	if err != nil {
+		t.Fatalf("err = %v, want reply", err)
+	}
+
+	if reply == nil {
+		t.Error("reply is nil")
+	}
+
+	if err := <-shortErr; err != context.DeadlineExceeded {
+		t.Errorf("err of short caller = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if stats := group.Stats(); stats.Calls != 1 || stats.Coalesced != 1 {
+		t.Errorf("stats = %+v, want 1 call and 1 coalesced", stats)
+	}
+}
+
+func TestFlightExpiredIsNotJoined(t *testing.T) {
+
+	group := NewFlightGroup()
+
+	// Call ignores cancellation, so it is still running after deadline
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	go group.Do(ctx, "key", func(ctx context.Context) (*querykit.QueryReply, error) {
+		<-release
+		return nil, ctx.Err()
+	})
+
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+
+	reply, err := group.Do(context.Background(), "key", func(ctx context.Context) (*querykit.QueryReply, error) {
+		return &querykit.QueryReply{}, nil
+	})
+	if err != nil || reply == nil {
+		t.Errorf("reply = %v, err = %v, want a new call", reply, err)
+	}
+}
+
+func TestFlightCanceledByLastCaller(t *testing.T) {
+
+	group := NewFlightGroup()
+
+	started := make(chan struct{})
+	finished := make(chan error, 1)
+	fn := func(ctx context.Context) (*querykit.QueryReply, error) {
+		close(started)
+		<-ctx.Done()
+		finished <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+
+	go group.Do(first, "key", fn)
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		group.Do(second, "key", fn)
+		close(done)
+	}()
+
+	// Wait for the second caller to join
+	for group.Stats().Coalesced == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelFirst()
+
+	select {
+	case <-finished:
+		t.Fatal("call is canceled while a caller is waiting")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	<-done
+
+	if err := <-finished; err != context.Canceled {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFlightCoalescing(t *testing.T) {
+
+	const n = 10
+
+	group := NewFlightGroup()
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (*querykit.QueryReply, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &querykit.QueryReply{Success: true}, nil
+	}
+
+	var wg sync.WaitGroup
+	replies := make([]*querykit.QueryReply, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			reply, err := group.Do(context.Background(), "key", fn)
+			if err != nil {
+				t.Error(err)
+			}
+
+			replies[i] = reply
+		}(i)
+	}
+
+	// All callers join the call before it is completed
+	for group.Stats().Coalesced < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+
+	for i, reply := range replies {
+		if reply != replies[0] {
+			t.Fatalf("reply %d is not shared", i)
+		}
+	}
+
+	stats := group.Stats()
+	if stats.Requests != n || stats.Calls != 1 || stats.Coalesced != n-1 || stats.InFlight != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Call after completion is not coalesced
+	group.Do(context.Background(), "key", fn)
+
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestFlightPanic(t *testing.T) {
+
+	const n = 5
+
+	group := NewFlightGroup()
+
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (*querykit.QueryReply, error) {
+		<-release
+		panic("broken")
+	}
+
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := group.Do(context.Background(), "key", fn)
+			errs <- err
+		}()
+	}
+
+	for group.Stats().Coalesced < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+
+	// Every caller gets error instead of waiting forever
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errs:
+			if err != ErrFlightInterrupted {
+				t.Errorf("err = %v, want %v", err, ErrFlightInterrupted)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("caller is still waiting")
+		}
+	}
+
+	// Key can be used again
+	reply, err := group.Do(context.Background(), "key", func(ctx context.Context) (*querykit.QueryReply, error) {
+		return &querykit.QueryReply{}, nil
+	})
+	if err != nil || reply == nil {
+		t.Errorf("reply = %v, err = %v", reply, err)
+	}
+}
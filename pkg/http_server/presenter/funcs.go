@@ -0,0 +1,499 @@
+package presenter
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var ErrNotNumber = errors.New("Not a number")
+
+// templateBuiltins are functions of text/template which are not able to be overridden by scripts
+var templateBuiltins = map[string]bool{
+	"and":      true,
+	"call":     true,
+	"html":     true,
+	"index":    true,
+	"slice":    true,
+	"js":       true,
+	"len":      true,
+	"not":      true,
+	"or":       true,
+	"print":    true,
+	"printf":   true,
+	"println":  true,
+	"urlquery": true,
+	"eq":       true,
+	"ge":       true,
+	"gt":       true,
+	"le":       true,
+	"lt":       true,
+	"ne":       true,
+}
+
+// templateFuncs returns functions for templates of states
+func templateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"counter": func(i int) int {
+			return i + 1
+		},
+
+		// JSON
+		"toJSON":     toJSON,
+		"jsonEscape": jsonEscape,
+
+		// Date
+		"now":        time.Now,
+		"formatDate": formatDate,
+		"parseDate":  parseDate,
+
+		// Number
+		"formatNumber": formatNumber,
+		"round":        round,
+		"add":          add,
+		"sub":          sub,
+		"mul":          mul,
+		"div":          div,
+		"mod":          mod,
+		"max":          max,
+		"min":          min,
+
+		// String
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      strings.Title,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old string, new string, s string) string { return strings.Replace(s, old, new, -1) },
+		"contains":   func(substr string, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix string, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep string, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"substr":     substr,
+		"padLeft":    padLeft,
+		"padRight":   padRight,
+		"mask":       mask,
+
+		// Value
+		"default": defaultValue,
+		"first":   first,
+		"last":    last,
+		"groupBy": groupBy,
+
+		// Encoding
+		"base64Encode": base64Encode,
+		"base64Decode": base64Decode,
+		"hexEncode":    hexEncode,
+		"hexDecode":    hexDecode,
+	}
+}
+
+// toJSON encodes value to be JSON
+func toJSON(value interface{}) (string, error) {
+
+	data, err := marshalJSON(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// jsonEscape escapes string to be used inside quotes of JSON string
+func jsonEscape(s string) (string, error) {
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), "\""), "\""), nil
+}
+
+// toTime converts time, unix timestamp in seconds and RFC3339 string to time
+func toTime(value interface{}) (time.Time, error) {
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		return *v, nil
+	case string:
+		return time.Parse(time.RFC3339, v)
+	}
+
+	f, err := toFloat(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Unable to convert %v to time", value)
+	}
+
+	sec, frac := math.Modf(f)
+
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
+
+// formatDate formats date with Go layout, value can be time, unix timestamp or RFC3339 string
+func formatDate(layout string, value interface{}) (string, error) {
+
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+
+	return t.Format(layout), nil
+}
+
+func parseDate(layout string, value string) (time.Time, error) {
+	return time.Parse(layout, value)
+}
+
+func toFloat(value interface{}) (float64, error) {
+
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case bool:
+		if v {
+			return 1, nil
+		}
+
+		return 0, nil
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+
+	return 0, ErrNotNumber
+}
+
+func isInteger(value interface{}) bool {
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+
+	return false
+}
+
+// calculate keeps integer if both values are integers
+func calculate(a interface{}, b interface{}, fn func(float64, float64) float64) (interface{}, error) {
+
+	x, err := toFloat(a)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	result := fn(x, y)
+	if isInteger(a) && isInteger(b) {
+		return int64(result), nil
+	}
+
+	return result, nil
+}
+
+func add(a interface{}, b interface{}) (interface{}, error) {
+	return calculate(a, b, func(x float64, y float64) float64 { return x + y })
+}
+
+func sub(a interface{}, b interface{}) (interface{}, error) {
+	return calculate(a, b, func(x float64, y float64) float64 { return x - y })
+}
+
+func mul(a interface{}, b interface{}) (interface{}, error) {
+	return calculate(a, b, func(x float64, y float64) float64 { return x * y })
+}
+
+func div(a interface{}, b interface{}) (interface{}, error) {
+
+	y, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if y == 0 {
+		return nil, errors.New("Division by zero")
+	}
+
+	return calculate(a, b, func(x float64, y float64) float64 { return x / y })
+}
+
+func mod(a interface{}, b interface{}) (interface{}, error) {
+
+	y, err := toFloat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if y == 0 {
+		return nil, errors.New("Division by zero")
+	}
+
+	return calculate(a, b, math.Mod)
+}
+
+func max(a interface{}, b interface{}) (interface{}, error) {
+	return calculate(a, b, math.Max)
+}
+
+func min(a interface{}, b interface{}) (interface{}, error) {
+	return calculate(a, b, math.Min)
+}
+
+func round(precision int, value interface{}) (float64, error) {
+
+	f, err := toFloat(value)
+	if err != nil {
+		return 0, err
+	}
+
+	p := math.Pow10(precision)
+
+	return math.Round(f*p) / p, nil
+}
+
+// formatNumber formats number with thousands separators and specific decimals
+func formatNumber(decimals int, value interface{}) (string, error) {
+
+	f, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+
+	parts := strings.SplitN(s, ".", 2)
+	integer := parts[0]
+
+	var buf strings.Builder
+	if f < 0 {
+		buf.WriteByte('-')
+	}
+
+	for i, c := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			buf.WriteByte(',')
+		}
+
+		buf.WriteRune(c)
+	}
+
+	if len(parts) == 2 {
+		buf.WriteByte('.')
+		buf.WriteString(parts[1])
+	}
+
+	return buf.String(), nil
+}
+
+func join(sep string, value interface{}) string {
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(value)
+	}
+
+	elements := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elements = append(elements, fmt.Sprint(v.Index(i).Interface()))
+	}
+
+	return strings.Join(elements, sep)
+}
+
+// substr returns characters from start to end, negative end means the end of string
+func substr(start int, end int, s string) string {
+
+	runes := []rune(s)
+
+	if start < 0 {
+		start = 0
+	}
+
+	if end < 0 || end > len(runes) {
+		end = len(runes)
+	}
+
+	if start >= end {
+		return ""
+	}
+
+	return string(runes[start:end])
+}
+
+func padLeft(length int, pad string, s string) string {
+
+	count := length - utf8.RuneCountInString(s)
+	if count <= 0 || len(pad) == 0 {
+		return s
+	}
+
+	return substr(0, count, strings.Repeat(pad, count)) + s
+}
+
+func padRight(length int, pad string, s string) string {
+
+	count := length - utf8.RuneCountInString(s)
+	if count <= 0 || len(pad) == 0 {
+		return s
+	}
+
+	return s + substr(0, count, strings.Repeat(pad, count))
+}
+
+// mask replaces characters with "*" but keeps specific number of characters at the start and the end
+func mask(keepStart int, keepEnd int, s string) string {
+
+	runes := []rune(s)
+	for i := range runes {
+		if i >= keepStart && i < len(runes)-keepEnd {
+			runes[i] = '*'
+		}
+	}
+
+	return string(runes)
+}
+
+func isEmpty(value interface{}) bool {
+
+	if value == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// defaultValue returns default value if value is empty
+func defaultValue(def interface{}, value interface{}) interface{} {
+
+	if isEmpty(value) {
+		return def
+	}
+
+	return value
+}
+
+func first(value interface{}) interface{} {
+
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+		return nil
+	}
+
+	return v.Index(0).Interface()
+}
+
+func last(value interface{}) interface{} {
+
+	v := reflect.ValueOf(value)
+	if (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+		return nil
+	}
+
+	return v.Index(v.Len() - 1).Interface()
+}
+
+type RecordGroup struct {
+	Key     interface{}
+	Records []map[string]interface{}
+}
+
+// groupBy groups records by field, groups are in the order of first appearance
+func groupBy(field string, records []map[string]interface{}) []*RecordGroup {
+
+	groups := make([]*RecordGroup, 0)
+	index := make(map[string]*RecordGroup)
+
+	for _, record := range records {
+
+		key := getValueFromObject(record, field)
+		id := fmt.Sprintf("%T:%v", key, key)
+
+		group, ok := index[id]
+		if !ok {
+			group = &RecordGroup{
+				Key:     key,
+				Records: make([]map[string]interface{}, 0),
+			}
+			index[id] = group
+			groups = append(groups, group)
+		}
+
+		group.Records = append(group.Records, record)
+	}
+
+	return groups
+}
+
+func toBytes(value interface{}) []byte {
+
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+
+	return []byte(fmt.Sprint(value))
+}
+
+func base64Encode(value interface{}) string {
+	return base64.StdEncoding.EncodeToString(toBytes(value))
+}
+
+func base64Decode(s string) (string, error) {
+
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func hexEncode(value interface{}) string {
+	return hex.EncodeToString(toBytes(value))
+}
+
+func hexDecode(s string) (string, error) {
+
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -0,0 +1,142 @@
+package presenter
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func renderFuncs(source string, data interface{}) (string, error) {
+
+	tmpl, err := template.New("test").Funcs(templateFuncs()).Parse(source)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func TestTemplateFuncs(t *testing.T) {
+
+	data := map[string]interface{}{
+		"name":    "Alice",
+		"phone":   "0912345678",
+		"amount":  1234567.891,
+		"count":   int64(7),
+		"created": int64(1609459200),
+		"tags":    []interface{}{"a", "b", "c"},
+		"empty":   "",
+		"records": []map[string]interface{}{
+			{"team": "red", "name": "a"},
+			{"team": "blue", "name": "b"},
+			{"team": "red", "name": "c"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"counter", `{{ counter 0 }}`, "1"},
+		{"toJSON", `{{ toJSON .tags }}`, `["a","b","c"]`},
+		{"jsonEscape", `{{ jsonEscape "say \"hi\"" }}`, `say \"hi\"`},
+		{"formatDate unix", `{{ formatDate "2006-01-02" .created }}`, time.Unix(1609459200, 0).Format("2006-01-02")},
+		{"formatDate string", `{{ formatDate "2006/01/02" "2021-03-04T05:06:07Z" }}`, "2021/03/04"},
+		{"parseDate", `{{ (parseDate "2006-01-02" "2021-03-04").Year }}`, "2021"},
+		{"formatNumber", `{{ formatNumber 2 .amount }}`, "1,234,567.89"},
+		{"formatNumber negative", `{{ formatNumber 0 -1234 }}`, "-1,234"},
+		{"formatNumber short", `{{ formatNumber 0 123 }}`, "123"},
+		{"round", `{{ round 1 3.14159 }}`, "3.1"},
+		{"add integers", `{{ add .count 3 }}`, "10"},
+		{"add floats", `{{ add 1.5 2 }}`, "3.5"},
+		{"add string", `{{ add "1" 2 }}`, "3"},
+		{"sub", `{{ sub .count 10 }}`, "-3"},
+		{"mul", `{{ mul .count 2 }}`, "14"},
+		{"div integers", `{{ div .count 2 }}`, "3"},
+		{"div floats", `{{ div 7.0 2 }}`, "3.5"},
+		{"mod", `{{ mod .count 4 }}`, "3"},
+		{"max", `{{ max .count 9 }}`, "9"},
+		{"min", `{{ min .count 9 }}`, "7"},
+		{"upper", `{{ upper .name }}`, "ALICE"},
+		{"lower", `{{ lower .name }}`, "alice"},
+		{"title", `{{ title "hello world" }}`, "Hello World"},
+		{"trim", `{{ trim "  x  " }}`, "x"},
+		{"trimPrefix", `{{ trimPrefix "09" .phone }}`, "12345678"},
+		{"trimSuffix", `{{ trimSuffix "78" .phone }}`, "09123456"},
+		{"replace", `{{ replace "l" "L" "hello" }}`, "heLLo"},
+		{"contains", `{{ contains "lic" .name }}`, "true"},
+		{"hasPrefix", `{{ hasPrefix "Al" .name }}`, "true"},
+		{"hasSuffix", `{{ hasSuffix "Al" .name }}`, "false"},
+		{"split", `{{ index (split "," "x,y") 1 }}`, "y"},
+		{"join", `{{ join "-" .tags }}`, "a-b-c"},
+		{"join scalar", `{{ join "-" .name }}`, "Alice"},
+		{"substr", `{{ substr 1 3 .name }}`, "li"},
+		{"substr to end", `{{ substr 2 -1 .name }}`, "ice"},
+		{"substr out of range", `{{ substr 4 2 .name }}`, ""},
+		{"substr unicode", `{{ substr 0 2 "中文字" }}`, "中文"},
+		{"padLeft", `{{ padLeft 5 "0" "42" }}`, "00042"},
+		{"padLeft long", `{{ padLeft 2 "0" "123" }}`, "123"},
+		{"padRight", `{{ padRight 5 "ab" "x" }}`, "xabab"},
+		{"mask", `{{ mask 4 3 .phone }}`, "0912***678"},
+		{"mask short", `{{ mask 4 3 "abc" }}`, "abc"},
+		{"default empty", `{{ default "none" .empty }}`, "none"},
+		{"default missing", `{{ default "none" .missing }}`, "none"},
+		{"default value", `{{ default "none" .name }}`, "Alice"},
+		{"first", `{{ first .tags }}`, "a"},
+		{"last", `{{ last .tags }}`, "c"},
+		{"first of empty", `{{ first .empty }}`, "<no value>"},
+		{"groupBy", `{{ range groupBy "team" .records }}{{ .Key }}:{{ len .Records }};{{ end }}`, "red:2;blue:1;"},
+		{"base64Encode", `{{ base64Encode "hello" }}`, "aGVsbG8="},
+		{"base64Decode", `{{ base64Decode "aGVsbG8=" }}`, "hello"},
+		{"hexEncode", `{{ hexEncode "hi" }}`, "6869"},
+		{"hexDecode", `{{ hexDecode "6869" }}`, "hi"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			result, err := renderFuncs(test.template, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != test.want {
+				t.Errorf("%s = %q, want %q", test.template, result, test.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncsErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"div by zero", `{{ div 1 0 }}`},
+		{"mod by zero", `{{ mod 1 0 }}`},
+		{"add not number", `{{ add "x" 1 }}`},
+		{"round not number", `{{ round 2 "x" }}`},
+		{"formatDate invalid", `{{ formatDate "2006" "yesterday" }}`},
+		{"base64Decode invalid", `{{ base64Decode "%%%" }}`},
+		{"hexDecode invalid", `{{ hexDecode "zz" }}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			_, err := renderFuncs(test.template, nil)
+			if err == nil {
+				t.Errorf("%s is expected to fail", test.template)
+			}
+		})
+	}
+}
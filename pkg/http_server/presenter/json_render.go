@@ -0,0 +1,337 @@
+package presenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Placeholders of envelope
+const (
+	placeholderRecords   = "$records"
+	placeholderRecord    = "$record"
+	placeholderCount     = "$count"
+	placeholderRequestID = "$requestId"
+	placeholderError     = "$error"
+	placeholderErrors    = "$errors"
+)
+
+type JSONRenderConfig struct {
+	Fields   []*JSONField    `json:"fields"`
+	Include  []string        `json:"include"`
+	Exclude  []string        `json:"exclude"`
+	Envelope json.RawMessage `json:"envelope"`
+	envelope interface{}
+	include  map[string]bool
+	exclude  map[string]bool
+}
+
+type JSONField struct {
+	Name  string      `json:"name"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// orderedObject keeps order of keys for output
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedObject() *orderedObject {
+	return &orderedObject{
+		keys:   make([]string, 0),
+		values: make(map[string]interface{}),
+	}
+}
+
+func (obj *orderedObject) Set(key string, value interface{}) {
+
+	if _, ok := obj.values[key]; !ok {
+		obj.keys = append(obj.keys, key)
+	}
+
+	obj.values[key] = value
+}
+
+// SetPath sets value with dot-separated path, objects will be created for parents
+func (obj *orderedObject) SetPath(path string, value interface{}) {
+
+	parts := strings.Split(path, ".")
+	cursor := obj
+	for _, name := range parts[:len(parts)-1] {
+
+		next, ok := cursor.values[name].(*orderedObject)
+		if !ok {
+			next = newOrderedObject()
+			cursor.Set(name, next)
+		}
+
+		cursor = next
+	}
+
+	cursor.Set(parts[len(parts)-1], value)
+}
+
+func (obj *orderedObject) MarshalJSON() ([]byte, error) {
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, key := range obj.keys {
+
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := marshalJSON(key)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := marshalJSON(obj.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (config *JSONRenderConfig) Init() error {
+
+	for _, field := range config.Fields {
+
+		if len(field.Name) == 0 {
+			return errors.New("Required name for field of JSON render")
+		}
+
+		if len(field.Path) == 0 && field.Value == nil {
+			field.Path = field.Name
+		}
+	}
+
+	config.include = make(map[string]bool, len(config.Include))
+	for _, name := range config.Include {
+		config.include[name] = true
+	}
+
+	config.exclude = make(map[string]bool, len(config.Exclude))
+	for _, name := range config.Exclude {
+		config.exclude[name] = true
+	}
+
+	if len(config.Envelope) > 0 {
+		envelope, err := parseOrderedJSON(config.Envelope)
+		if err != nil {
+			return err
+		}
+
+		config.envelope = envelope
+	}
+
+	return nil
+}
+
+func (config *JSONRenderConfig) Render(data *ViewData) ([]byte, error) {
+
+	records := make([]interface{}, 0, len(data.Records))
+	for _, record := range data.Records {
+		records = append(records, config.mapRecord(record))
+	}
+
+	if config.envelope == nil {
+		return marshalJSON(records)
+	}
+
+	return marshalJSON(config.fill(config.envelope, records, data))
+}
+
+// RenderLines writes records as newline-delimited JSON
+func (config *JSONRenderConfig) RenderLines(w io.Writer, data *ViewData) error {
+
+	return data.eachRecord(func(record map[string]interface{}) error {
+
+		line, err := marshalJSON(config.mapRecord(record))
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(append(line, '\n'))
+
+		return err
+	})
+}
+
+func (config *JSONRenderConfig) mapRecord(record map[string]interface{}) *orderedObject {
+
+	obj := newOrderedObject()
+
+	// Mapping with fields
+	if len(config.Fields) > 0 {
+		for _, field := range config.Fields {
+
+			if len(field.Path) == 0 {
+				obj.SetPath(field.Name, field.Value)
+				continue
+			}
+
+			obj.SetPath(field.Name, getValueFromObject(record, field.Path))
+		}
+
+		return obj
+	}
+
+	keys := make([]string, 0, len(record))
+	for key := range record {
+
+		if len(config.include) > 0 && !config.include[key] {
+			continue
+		}
+
+		if config.exclude[key] {
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		obj.Set(key, record[key])
+	}
+
+	return obj
+}
+
+// fill replaces placeholders of envelope
+func (config *JSONRenderConfig) fill(value interface{}, records []interface{}, data *ViewData) interface{} {
+
+	switch v := value.(type) {
+	case *orderedObject:
+		obj := newOrderedObject()
+		for _, key := range v.keys {
+			obj.Set(key, config.fill(v.values[key], records, data))
+		}
+
+		return obj
+	case []interface{}:
+		arr := make([]interface{}, 0, len(v))
+		for _, ele := range v {
+			arr = append(arr, config.fill(ele, records, data))
+		}
+
+		return arr
+	case string:
+		switch v {
+		case placeholderRecords:
+			return records
+		case placeholderRecord:
+			if len(records) == 0 {
+				return nil
+			}
+
+			return records[0]
+		case placeholderCount:
+			return len(records)
+		case placeholderRequestID:
+			return data.RequestID
+		case placeholderError:
+			return data.Error
+		case placeholderErrors:
+			return data.Errors
+		}
+	}
+
+	return value
+}
+
+// parseOrderedJSON decodes JSON and keeps order of object keys
+func parseOrderedJSON(data []byte) (interface{}, error) {
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	return parseOrderedValue(decoder)
+}
+
+func parseOrderedValue(decoder *json.Decoder) (interface{}, error) {
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := newOrderedObject()
+		for decoder.More() {
+
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := parseOrderedValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			obj.Set(key.(string), value)
+		}
+
+		// End of object
+		_, err := decoder.Token()
+
+		return obj, err
+	case '[':
+		arr := make([]interface{}, 0)
+		for decoder.More() {
+
+			value, err := parseOrderedValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			arr = append(arr, value)
+		}
+
+		// End of array
+		_, err := decoder.Token()
+
+		return arr, err
+	}
+
+	return nil, fmt.Errorf("Unexpected token %v", delim)
+}
+
+func marshalJSON(value interface{}) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove newline which is added by encoder
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
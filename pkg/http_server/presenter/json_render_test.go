@@ -0,0 +1,277 @@
+package presenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// Text which must be escaped in JSON, and HTML which must not be
+const specialText = "say \"hi\" \\ C:\\path\nnew line\r\ttab \u0000\u0001\u001f </script> & \u2028"
+
+func newTestJSONRender(t *testing.T, source string) *JSONRenderConfig {
+
+	config := &JSONRenderConfig{}
+	if err := json.Unmarshal([]byte(source), config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+func TestJSONRenderEscaping(t *testing.T) {
+
+	config := newTestJSONRender(t, `{}`)
+
+	data := &ViewData{
+		Records: []map[string]interface{}{
+			{"id": int64(1), "name": specialText, specialText: "key"},
+		},
+	}
+
+	output, err := config.Render(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid(output) {
+		t.Fatalf("invalid JSON: %s", output)
+	}
+
+	var records []map[string]interface{}
+	if err := json.Unmarshal(output, &records); err != nil {
+		t.Fatal(err)
+	}
+
+	if records[0]["name"] != specialText || records[0][specialText] != "key" {
+		t.Errorf("record = %#v", records[0])
+	}
+
+	// HTML is not escaped for JSON
+	if !bytes.Contains(output, []byte("</script> &")) {
+		t.Errorf("HTML is escaped: %s", output)
+	}
+
+	// Every line of NDJSON is valid
+	var buf bytes.Buffer
+	if err := config.RenderLines(&buf, data); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	if len(lines) != 1 || !json.Valid(lines[0]) {
+		t.Errorf("lines = %q", lines)
+	}
+}
+
+func TestJSONRenderEnvelope(t *testing.T) {
+
+	config := newTestJSONRender(t, `{
+		"envelope": {
+			"data": "$records",
+			"first": "$record",
+			"meta": { "count": "$count", "requestId": "$requestId", "version": 1.0, "tags": [ "$count", "text" ] },
+			"error": "$error",
+			"errors": "$errors"
+		}
+	}`)
+
+	tests := []struct {
+		name   string
+		data   *ViewData
+		output string
+	}{
+		{
+			"records",
+			&ViewData{
+				Records:   []map[string]interface{}{{"name": specialText}, {"name": "b"}},
+				RequestID: "req\"1",
+			},
+			`{"data":[{"name":"say \"hi\" \\ C:\\path\nnew line\r\ttab \u0000\u0001\u001f </script> & \u2028"},{"name":"b"}],` +
+				`"first":{"name":"say \"hi\" \\ C:\\path\nnew line\r\ttab \u0000\u0001\u001f </script> & \u2028"},` +
+				`"meta":{"count":2,"requestId":"req\"1","version":1.0,"tags":[2,"text"]},"error":null,"errors":null}`,
+		},
+		{
+			"no records",
+			&ViewData{
+				Records: []map[string]interface{}{},
+				Error:   &ErrorData{Kind: "query", Message: "line\nbreak"},
+				Errors:  []*ValidationError{{In: "query", Field: "id", Message: "is \"required\""}},
+			},
+			`{"data":[],"first":null,"meta":{"count":0,"requestId":"","version":1.0,"tags":[0,"text"]},` +
+				`"error":{"kind":"query","message":"line\nbreak"},"errors":[{"in":"query","field":"id","message":"is \"required\""}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			output, err := config.Render(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !json.Valid(output) {
+				t.Fatalf("invalid JSON: %s", output)
+			}
+
+			// Keys of envelope keep their order
+			if string(output) != test.output {
+				t.Errorf("output = %s, want %s", output, test.output)
+			}
+		})
+	}
+}
+
+func TestJSONRenderFields(t *testing.T) {
+
+	record := map[string]interface{}{
+		"id":      int64(1),
+		"name":    "alice",
+		"secret":  "x",
+		"profile": map[string]interface{}{"city": "Taipei"},
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		output string
+	}{
+		{"all", `{}`, `{"id":1,"name":"alice","profile":{"city":"Taipei"},"secret":"x"}`},
+		{"include", `{ "include": [ "id", "secret", "missing" ] }`, `{"id":1,"secret":"x"}`},
+		{"exclude", `{ "exclude": [ "secret", "name" ] }`, `{"id":1,"profile":{"city":"Taipei"}}`},
+		{
+			"fields",
+			`{ "fields": [
+				{ "name": "city", "path": "profile.city" },
+				{ "name": "user.id", "path": "id" },
+				{ "name": "user.name", "path": "name" },
+				{ "name": "missing", "path": "profile.zip" },
+				{ "name": "type", "value": "account" },
+				{ "name": "id" }
+			] }`,
+			`{"city":"Taipei","user":{"id":1,"name":"alice"},"missing":null,"type":"account","id":1}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			config := newTestJSONRender(t, test.config)
+
+			output, err := config.Render(&ViewData{Records: []map[string]interface{}{record}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !json.Valid(output) {
+				t.Fatalf("invalid JSON: %s", output)
+			}
+
+			// Keys of fields keep their order, and the rest are sorted
+			if string(output) != "["+test.output+"]" {
+				t.Errorf("output = %s, want [%s]", output, test.output)
+			}
+		})
+	}
+}
+
+func TestTemplateJSONFuncs(t *testing.T) {
+
+	data := map[string]interface{}{
+		"name": specialText,
+		"record": map[string]interface{}{
+			"id":   int64(1),
+			"name": specialText,
+			"tags": []interface{}{"a", specialText},
+		},
+	}
+
+	output, err := renderFuncs(`{"name":"{{ jsonEscape .name }}","record":{{ toJSON .record }},"raw":{{ toJSON .name }}}`, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !json.Valid([]byte(output)) {
+		t.Fatalf("invalid JSON: %s", output)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["name"] != specialText || doc["raw"] != specialText {
+		t.Errorf("name = %q, raw = %q", doc["name"], doc["raw"])
+	}
+
+	record := doc["record"].(map[string]interface{})
+	if record["name"] != specialText || record["tags"].([]interface{})[1] != specialText {
+		t.Errorf("record = %#v", record)
+	}
+}
+
+func TestRenderJSONResponse(t *testing.T) {
+
+	fixture, err := toJSON([]map[string]interface{}{
+		{"id": 1, "name": specialText, "secret": "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presenter := newTestPresenter(t, map[string]string{
+		"endpoint.json": `{
+			"method": "get",
+			"uri": "/accounts",
+			"query": { "table": "accounts" },
+			"response": {
+				"state": {
+					"success": {
+						"render": "json",
+						"json": {
+							"exclude": [ "secret" ],
+							"envelope": { "count": "$count", "data": "$records", "requestId": "$requestId" }
+						}
+					}
+				}
+			}
+		}`,
+	}, map[string]string{
+		"accounts.json": fixture,
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+
+	w := serveTest(presenter, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("code = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	if !json.Valid(w.Body.Bytes()) {
+		t.Fatalf("invalid JSON: %s", w.Body.String())
+	}
+
+	var doc struct {
+		Count     int                      `json:"count"`
+		Data      []map[string]interface{} `json:"data"`
+		RequestID string                   `json:"requestId"`
+	}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []map[string]interface{}{{"id": 1.0, "name": specialText}}
+	if doc.Count != 1 || doc.RequestID != "req-1" || !reflect.DeepEqual(doc.Data, want) {
+		t.Errorf("document = %+v", doc)
+	}
+}
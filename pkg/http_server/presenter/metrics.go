@@ -0,0 +1,32 @@
+package presenter
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// initMetrics serves statistics of presenter as JSON
+func (presenter *Presenter) initMetrics() {
+
+	if !viper.GetBool("metrics.enabled") {
+		return
+	}
+
+	metricsPath := viper.GetString("metrics.path")
+	if len(metricsPath) == 0 {
+		metricsPath = "/metrics"
+	}
+
+	presenter.server.GetEngine().GET(metricsPath, func(c *gin.Context) {
+		c.JSON(http.StatusOK, presenter.Metrics())
+	})
+}
+
+// Metrics returns statistics of presenter
+func (presenter *Presenter) Metrics() map[string]interface{} {
+	return map[string]interface{}{
+		"query": presenter.dataSources.Stats(),
+	}
+}
@@ -0,0 +1,116 @@
+package presenter
+
+import (
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Media types for "format" query parameter
+var formatTypes = map[string]string{
+	"json":   "application/json",
+	"xml":    "application/xml",
+	"html":   "text/html",
+	"text":   "text/plain",
+	"csv":    "text/csv",
+	"ndjson": "application/x-ndjson",
+}
+
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns media ranges of Accept header in order of preference
+func parseAccept(accept string) []*mediaRange {
+
+	ranges := make([]*mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = v
+			}
+		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, &mediaRange{
+			mediaType: mediaType,
+			quality:   quality,
+		})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	return ranges
+}
+
+func (mr *mediaRange) match(mediaType string) bool {
+
+	if mr.mediaType == "*/*" || mr.mediaType == mediaType {
+		return true
+	}
+
+	if strings.HasSuffix(mr.mediaType, "/*") {
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mr.mediaType, "*"))
+	}
+
+	return false
+}
+
+// negotiate selects representation with "format" query parameter or Accept header,
+// nil will be returned if nothing is acceptable, even if state has only one representation.
+func (state *StateDefinition) negotiate(c *gin.Context) *Representation {
+
+	// Format is specified by query parameter
+	if format := c.Query("format"); len(format) > 0 {
+
+		mediaType, ok := formatTypes[format]
+		if !ok {
+			mediaType = format
+		}
+
+		for _, rep := range state.representations {
+			if rep.mediaType == mediaType {
+				return rep
+			}
+		}
+
+		return nil
+	}
+
+	accept := c.GetHeader("Accept")
+	if len(accept) == 0 {
+		return state.defaultRepresentation
+	}
+
+	for _, mr := range parseAccept(accept) {
+
+		// Default representation is preferred for wildcards
+		if mr.match(state.defaultRepresentation.mediaType) {
+			return state.defaultRepresentation
+		}
+
+		for _, rep := range state.representations {
+			if mr.match(rep.mediaType) {
+				return rep
+			}
+		}
+	}
+
+	return nil
+}
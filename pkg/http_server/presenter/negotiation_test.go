@@ -0,0 +1,148 @@
+package presenter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const negotiationEndpoint = `{
+	"method": "get",
+	"uri": "/accounts",
+	"query": { "table": "accounts" },
+	"response": {
+		"state": {
+			"success": {
+				"contentType": "application/json",
+				"representations": {
+					"application/json": { "render": "json" },
+					"text/csv": { "render": "csv" },
+					"text/html": { "template": "accounts.html.tmpl" }
+				}
+			}
+		}
+	}
+}`
+
+const singleEndpoint = `{
+	"method": "get",
+	"uri": "/single",
+	"query": { "table": "accounts" },
+	"response": {
+		"state": {
+			"success": { "render": "json" }
+		}
+	}
+}`
+
+func TestParseAccept(t *testing.T) {
+
+	ranges := parseAccept("text/html;q=0.5, application/json, invalid/, text/*;q=0.8, */*;q=0, text/csv;q=x")
+
+	want := []mediaRange{
+		{"application/json", 1},
+		{"text/csv", 1},
+		{"text/*", 0.8},
+		{"text/html", 0.5},
+	}
+
+	if len(ranges) != len(want) {
+		t.Fatalf("ranges = %d, want %d", len(ranges), len(want))
+	}
+
+	for i, mr := range ranges {
+		if *mr != want[i] {
+			t.Errorf("range %d = %+v, want %+v", i, *mr, want[i])
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+
+	presenter := newTestPresenter(t, map[string]string{
+		"accounts.json":      negotiationEndpoint,
+		"single.json":        singleEndpoint,
+		"accounts.html.tmpl": `{{ range .Records }}<p>{{ .name }}</p>{{ end }}`,
+	}, map[string]string{
+		"accounts.json": `[{ "id": 1, "name": "alice" }]`,
+	})
+
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		code        int
+		contentType string
+	}{
+		{"default", "/accounts", "", 200, "application/json"},
+		{"exact", "/accounts", "text/html", 200, "text/html"},
+		{"quality", "/accounts", "text/html;q=0.5, text/csv;q=0.9", 200, "text/csv"},
+		{"quality of default", "/accounts", "text/html;q=0.5, application/json;q=0.4", 200, "text/html"},
+		{"wildcard", "/accounts", "*/*", 200, "application/json"},
+		{"wildcard with preference", "/accounts", "text/html, */*;q=0.1", 200, "text/html"},
+		{"subtype wildcard", "/accounts", "text/*", 200, "text/csv"},
+		{"refused by quality", "/accounts", "text/html;q=0, application/xml", 406, "application/json"},
+		{"format", "/accounts?format=html", "application/json", 200, "text/html"},
+		{"format of media type", "/accounts?format=text/csv", "", 200, "text/csv"},
+		{"unknown format", "/accounts?format=xml", "", 406, "application/json"},
+		{"not acceptable", "/accounts", "application/xml", 406, "application/json"},
+		{"single", "/single", "", 200, "application/json"},
+		{"single with wildcard", "/single", "application/*", 200, "application/json"},
+		{"single not acceptable", "/single", "application/xml", 406, "application/json"},
+		{"single with format", "/single?format=json", "", 200, "application/json"},
+		{"single with unknown format", "/single?format=csv", "", 406, "application/json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			if len(test.accept) > 0 {
+				req.Header.Set("Accept", test.accept)
+			}
+
+			w := serveTest(presenter, req)
+			if w.Code != test.code {
+				t.Fatalf("code = %d, want %d, body = %s", w.Code, test.code, w.Body.String())
+			}
+
+			if mediaType := w.Header().Get("Content-Type"); !strings.HasPrefix(mediaType, test.contentType) {
+				t.Errorf("Content-Type = %s, want %s", mediaType, test.contentType)
+			}
+
+			if test.code != http.StatusNotAcceptable {
+				return
+			}
+
+			// Built-in error of not_acceptable state
+			var body struct {
+				Error ErrorData `json:"error"`
+			}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+
+			if body.Error.Kind != "negotiation" {
+				t.Errorf("kind = %s, want negotiation", body.Error.Kind)
+			}
+		})
+	}
+}
+
+func TestNegotiateVary(t *testing.T) {
+
+	presenter := newTestPresenter(t, map[string]string{
+		"accounts.json":      negotiationEndpoint,
+		"accounts.html.tmpl": `{{ .Records }}`,
+	}, map[string]string{
+		"accounts.json": `[{ "id": 1, "name": "alice" }]`,
+	})
+
+	w := serveTest(presenter, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+	if vary := w.Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Vary = %q, want Accept", vary)
+	}
+}
@@ -0,0 +1,407 @@
+package presenter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// defaultSwaggerUIAssets is the pinned release of Swagger UI which is loaded by browsers from CDN
+const defaultSwaggerUIAssets = "https://unpkg.com/swagger-ui-dist@3.52.5"
+
+var ErrSwaggerUIIntegrity = errors.New("Required uiIntegrity for assets of Swagger UI from other origin")
+
+const swaggerUITemplate = `<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="UTF-8"/>
+		<title>%[1]s</title>
+		<link rel="stylesheet" href="%[2]s/swagger-ui.css"%[4]s crossorigin="anonymous"/>
+	</head>
+	<body>
+		<div id="swagger-ui"></div>
+		<script src="%[2]s/swagger-ui-bundle.js"%[5]s crossorigin="anonymous"></script>
+		<script>
+			window.onload = function() {
+				SwaggerUIBundle({
+					url: "%[3]s",
+					dom_id: "#swagger-ui"
+				});
+			};
+		</script>
+	</body>
+</html>
+`
+
+type OpenAPIDocument map[string]interface{}
+
+func NewOpenAPIDocument(endpoints map[string]*Endpoint) OpenAPIDocument {
+
+	title := viper.GetString("openapi.title")
+	if len(title) == 0 {
+		title = "Gravity Presenter"
+	}
+
+	version := viper.GetString("openapi.version")
+	if len(version) == 0 {
+		version = "1.0.0"
+	}
+
+	// Sort by name to generate the same document every time
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	paths := make(map[string]interface{})
+	for _, name := range names {
+		endpoint := endpoints[name]
+
+		uri, pathParams := convertURI(endpoint.uri)
+
+		item, ok := paths[uri].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[uri] = item
+		}
+
+		item[endpoint.method] = endpoint.openAPIOperation(pathParams)
+	}
+
+	return OpenAPIDocument{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+	}
+}
+
+// ExportOpenAPI loads endpoints from settings and writes OpenAPI document to file
+func ExportOpenAPI(settingsPath string, filename string) error {
+
+	presenter := NewPresenter(nil)
+	endpoints, _, err := presenter.loadSettings(settingsPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(NewOpenAPIDocument(endpoints), "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// convertURI converts gin path parameters to OpenAPI style
+func convertURI(uri string) (string, []string) {
+
+	params := make([]string, 0)
+	parts := strings.Split(uri, "/")
+	for i, part := range parts {
+
+		if len(part) == 0 || (part[0] != ':' && part[0] != '*') {
+			continue
+		}
+
+		params = append(params, part[1:])
+		parts[i] = "{" + part[1:] + "}"
+	}
+
+	return strings.Join(parts, "/"), params
+}
+
+func (endpoint *Endpoint) openAPIOperation(pathParams []string) map[string]interface{} {
+
+	operation := map[string]interface{}{
+		"operationId": endpoint.name,
+	}
+
+	request := endpoint.request
+	if request == nil {
+		request = &RequestConfig{}
+	}
+
+	// Parameters
+	parameters := make([]interface{}, 0)
+	for _, name := range pathParams {
+
+		schema := map[string]interface{}{
+			"type": "string",
+		}
+
+		if rule, ok := request.Params[name]; ok {
+			schema = rule.openAPISchema()
+		}
+
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+
+	parameters = append(parameters, openAPIParameters("query", request.Query)...)
+	parameters = append(parameters, openAPIParameters("header", request.Headers)...)
+
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	// Request body
+	if len(request.Body) > 0 {
+		operation["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				gin.MIMEJSON: map[string]interface{}{
+					"schema": openAPIBodySchema(request.Body),
+				},
+			},
+		}
+	}
+
+	// Responses
+	responses := make(map[string]interface{})
+	for stateName, state := range endpoint.openAPIStates() {
+
+		code := fmt.Sprintf("%d", state.Code)
+
+		response, ok := responses[code].(map[string]interface{})
+		if !ok {
+			response = map[string]interface{}{
+				"content": make(map[string]interface{}),
+			}
+			responses[code] = response
+		}
+
+		// States which have the same status code are sharing the same response
+		if desc, ok := response["description"].(string); ok {
+			names := append(strings.Split(desc, ", "), stateName)
+			sort.Strings(names)
+			response["description"] = strings.Join(names, ", ")
+		} else {
+			response["description"] = stateName
+		}
+
+		for _, rep := range state.representations {
+			response["content"].(map[string]interface{})[rep.ContentType] = map[string]interface{}{}
+		}
+	}
+
+	operation["responses"] = responses
+
+	return operation
+}
+
+func (endpoint *Endpoint) openAPIStates() map[string]*StateDefinition {
+
+	states := make(map[string]*StateDefinition, len(endpoint.states))
+	for name, state := range endpoint.states {
+		states[name] = state
+	}
+
+	// Built-in response for validation
+	if _, ok := states["bad_request"]; !ok && endpoint.request != nil {
+		state := errorStates["bad_request"]
+		state.representations = []*Representation{&state.Representation}
+		states["bad_request"] = &state
+	}
+
+	return states
+}
+
+func openAPIParameters(in string, rules map[string]*FieldRule) []interface{} {
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parameters := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		rule := rules[name]
+		parameters = append(parameters, map[string]interface{}{
+			"name":     name,
+			"in":       in,
+			"required": rule.Required,
+			"schema":   rule.openAPISchema(),
+		})
+	}
+
+	return parameters
+}
+
+// openAPIBodySchema generates object schema with dot-separated paths of fields
+func openAPIBodySchema(rules map[string]*FieldRule) map[string]interface{} {
+
+	root := map[string]interface{}{
+		"type":       "object",
+		"properties": make(map[string]interface{}),
+	}
+
+	for path, rule := range rules {
+
+		parts := strings.Split(path, ".")
+		cursor := root
+		for i, name := range parts {
+
+			properties := cursor["properties"].(map[string]interface{})
+
+			if i == len(parts)-1 {
+				properties[name] = rule.openAPISchema()
+
+				if rule.Required {
+					required, _ := cursor["required"].([]string)
+					required = append(required, name)
+					sort.Strings(required)
+					cursor["required"] = required
+				}
+
+				break
+			}
+
+			next, ok := properties[name].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{
+					"type":       "object",
+					"properties": make(map[string]interface{}),
+				}
+				properties[name] = next
+			}
+
+			cursor = next
+		}
+	}
+
+	return root
+}
+
+func (rule *FieldRule) openAPISchema() map[string]interface{} {
+
+	schema := make(map[string]interface{})
+
+	if len(rule.Type) > 0 {
+		schema["type"] = rule.Type
+	}
+
+	if len(rule.Pattern) > 0 {
+		schema["pattern"] = rule.Pattern
+	}
+
+	if len(rule.Enum) > 0 {
+		schema["enum"] = rule.Enum
+	}
+
+	if rule.Default != nil {
+		schema["default"] = rule.Default
+	}
+
+	minKey, maxKey := "minimum", "maximum"
+	switch rule.Type {
+	case "string":
+		minKey, maxKey = "minLength", "maxLength"
+	case "array":
+		minKey, maxKey = "minItems", "maxItems"
+	}
+
+	if rule.Min != nil {
+		schema[minKey] = *rule.Min
+	}
+
+	if rule.Max != nil {
+		schema[maxKey] = *rule.Max
+	}
+
+	return schema
+}
+
+func (presenter *Presenter) initOpenAPI() error {
+
+	if !viper.GetBool("openapi.enabled") {
+		return nil
+	}
+
+	engine := presenter.server.GetEngine()
+
+	specPath := viper.GetString("openapi.path")
+	if len(specPath) == 0 {
+		specPath = "/openapi.json"
+	}
+
+	// Document is always generated with the latest endpoints
+	engine.GET(specPath, func(c *gin.Context) {
+
+		endpoints := make(map[string]*Endpoint)
+		if table := presenter.router.GetTable(); table != nil {
+			endpoints = table.endpoints
+		}
+
+		c.JSON(http.StatusOK, NewOpenAPIDocument(endpoints))
+	})
+
+	if !viper.GetBool("openapi.ui") {
+		return nil
+	}
+
+	uiPath := viper.GetString("openapi.uiPath")
+	if len(uiPath) == 0 {
+		uiPath = "/docs"
+	}
+
+	page, err := swaggerUIPage(specPath)
+	if err != nil {
+		return err
+	}
+
+	engine.GET(uiPath, func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+	})
+
+	return nil
+}
+
+// swaggerUIPage generates page of Swagger UI, assets from other origin are checked by browsers with integrity
+func swaggerUIPage(specPath string) (string, error) {
+
+	// Assets of Swagger UI are not embedded, they can be hosted elsewhere for offline networks
+	assets := strings.TrimSuffix(viper.GetString("openapi.uiAssets"), "/")
+	if len(assets) == 0 {
+		assets = defaultSwaggerUIAssets
+	}
+
+	assetsURL, err := url.Parse(assets)
+	if err != nil {
+		return "", err
+	}
+
+	css := viper.GetString("openapi.uiIntegrity.css")
+	js := viper.GetString("openapi.uiIntegrity.js")
+	if len(assetsURL.Host) > 0 && (len(css) == 0 || len(js) == 0) {
+		return "", ErrSwaggerUIIntegrity
+	}
+
+	integrity := func(hash string) string {
+		if len(hash) == 0 {
+			return ""
+		}
+
+		return fmt.Sprintf(` integrity="%s"`, html.EscapeString(hash))
+	}
+
+	return fmt.Sprintf(swaggerUITemplate, "API Documentation", assets, specPath, integrity(css), integrity(js)), nil
+}
@@ -0,0 +1,81 @@
+package presenter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSwaggerUIPage(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		assets   string
+		css      string
+		js       string
+		contains []string
+		err      error
+	}{
+		{"default CDN without integrity", "", "", "", nil, ErrSwaggerUIIntegrity},
+		{"CDN with partial integrity", "https://cdn.example.com/swagger-ui/", "sha384-css", "", nil, ErrSwaggerUIIntegrity},
+		{"protocol relative without integrity", "//cdn.example.com/swagger-ui", "", "", nil, ErrSwaggerUIIntegrity},
+		{
+			"default CDN with integrity",
+			"",
+			"sha384-css",
+			"sha384-js",
+			[]string{
+				`<link rel="stylesheet" href="` + defaultSwaggerUIAssets + `/swagger-ui.css" integrity="sha384-css" crossorigin="anonymous"/>`,
+				`<script src="` + defaultSwaggerUIAssets + `/swagger-ui-bundle.js" integrity="sha384-js" crossorigin="anonymous"></script>`,
+				`url: "/openapi.json"`,
+			},
+			nil,
+		},
+		{
+			"same origin without integrity",
+			"/swagger-ui/",
+			"",
+			"",
+			[]string{
+				`<link rel="stylesheet" href="/swagger-ui/swagger-ui.css" crossorigin="anonymous"/>`,
+				`<script src="/swagger-ui/swagger-ui-bundle.js" crossorigin="anonymous"></script>`,
+			},
+			nil,
+		},
+		{
+			"escaped integrity",
+			"/swagger-ui",
+			`sha384-"css"`,
+			"sha384-js",
+			[]string{`integrity="sha384-&#34;css&#34;"`},
+			nil,
+		},
+	}
+
+	t.Cleanup(func() {
+		viper.Set("openapi.uiAssets", nil)
+		viper.Set("openapi.uiIntegrity.css", nil)
+		viper.Set("openapi.uiIntegrity.js", nil)
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			viper.Set("openapi.uiAssets", test.assets)
+			viper.Set("openapi.uiIntegrity.css", test.css)
+			viper.Set("openapi.uiIntegrity.js", test.js)
+
+			page, err := swaggerUIPage("/openapi.json")
+			if err != test.err {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+
+			for _, s := range test.contains {
+				if !strings.Contains(page, s) {
+					t.Errorf("page doesn't contain %s\n%s", s, page)
+				}
+			}
+		})
+	}
+}
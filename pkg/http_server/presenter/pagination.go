@@ -5,16 +5,36 @@ import (
 )
 
 type Pagination struct {
-	Limit   interface{} `json:"limit"`
-	Page    interface{} `json:"page"`
-	Runtime *goja.Runtime
+	Limit interface{} `json:"limit"`
+	Page  interface{} `json:"page"`
+
+	limitProgram *goja.Program
+	pageProgram  *goja.Program
 }
 
 func New() *Pagination {
 	return &Pagination{}
 }
 
-func (pagination *Pagination) InitRuntime() {
-	pagination.Runtime = goja.New()
-	pagination.Runtime.SetFieldNameMapper(goja.UncapFieldNameMapper())
+func (pagination *Pagination) Compile() error {
+
+	if script, ok := pagination.Limit.(string); ok {
+		program, err := CompileScript("limit", script)
+		if err != nil {
+			return err
+		}
+
+		pagination.limitProgram = program
+	}
+
+	if script, ok := pagination.Page.(string); ok {
+		program, err := CompileScript("page", script)
+		if err != nil {
+			return err
+		}
+
+		pagination.pageProgram = program
+	}
+
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 type Connection struct {
@@ -17,3 +18,18 @@ func NewConnection(c *grpc.ClientConn) *Connection {
 		updatedTime: time.Now(),
 	}
 }
+
+// isHealthy returns false if connection doesn't work
+func (c *Connection) isHealthy() bool {
+
+	state := c.connection.GetState()
+	if state == connectivity.Shutdown || state == connectivity.TransientFailure {
+		return false
+	}
+
+	return true
+}
+
+func (c *Connection) isIdle(timeout time.Duration) bool {
+	return timeout > 0 && time.Since(c.updatedTime) > timeout
+}
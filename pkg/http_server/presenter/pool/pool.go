@@ -1,43 +1,76 @@
 package pool
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/connectivity"
 )
 
-var ErrExceeded = errors.New("Maximum number of connections exceeded")
+var (
+	ErrExceeded = errors.New("Maximum number of connections exceeded")
+	ErrClosed   = errors.New("Connection pool is closed")
+)
 
 type GRPCPool struct {
 	host        string
 	options     *Options
 	dialOptions []grpc.DialOption
-	connections chan *Connection
-	pending     chan *grpc.ClientConn
-	connCount   uint32
 
-	mutex sync.RWMutex
+	// Idle connections, the most recently used one is the last
+	idle    []*Connection
+	open    int
+	inUse   int
+	waiters *list.List
+	closed  bool
+	drained chan struct{}
+	done    chan struct{}
+
+	dialFailures uint64
+	waitCount    uint64
+	evicted      uint64
+
+	mutex sync.Mutex
+}
+
+// Stats is statistics of connection pool
+type Stats struct {
+	Open         int    `json:"open"`
+	Idle         int    `json:"idle"`
+	InUse        int    `json:"inUse"`
+	Waiting      int    `json:"waiting"`
+	DialFailures uint64 `json:"dialFailures"`
+	WaitCount    uint64 `json:"waitCount"`
+	Evicted      uint64 `json:"evicted"`
 }
 
+// waiter receives a connection, or nil if it should try again
+type waiter chan *Connection
+
 func NewGRPCPool(host string, options *Options, dialOptions ...grpc.DialOption) (*GRPCPool, error) {
 
 	pool := &GRPCPool{
 		host:        host,
 		options:     options,
 		dialOptions: dialOptions,
-		connections: make(chan *Connection, options.MaxCap),
-		connCount:   0,
+		idle:        make([]*Connection, 0, options.MaxCap),
+		waiters:     list.New(),
+		drained:     make(chan struct{}),
+		done:        make(chan struct{}),
 	}
 
 	err := pool.init()
 	if err != nil {
+		pool.Close(context.Background())
 		return nil, err
 	}
 
+	go pool.evict()
+
 	return pool, nil
 }
 
@@ -49,128 +82,276 @@ func (pool *GRPCPool) init() error {
 	}).Info("Initializing gRPC connection pool ...")
 
 	// Initializing connections
-	for i := 0; i < pool.options.InitCap; i++ {
+	for i := 0; i < pool.options.InitCap && i < pool.options.MaxCap; i++ {
+
+		pool.mutex.Lock()
+		pool.open++
+		pool.mutex.Unlock()
 
 		// Create connection
-		connection, err := pool.factory()
+		connection, err := pool.factory(context.Background())
 		if err != nil {
+			pool.mutex.Lock()
+			pool.open--
+			pool.mutex.Unlock()
 			return err
 		}
 
-		pool.connections <- NewConnection(connection)
+		pool.mutex.Lock()
+		pool.idle = append(pool.idle, NewConnection(connection))
+		pool.mutex.Unlock()
 	}
 
 	return nil
 }
 
-func (pool *GRPCPool) ref() (uint32, error) {
+func (pool *GRPCPool) factory(ctx context.Context) (*grpc.ClientConn, error) {
 
-	pool.mutex.Lock()
+	log.WithFields(log.Fields{
+		"host": pool.host,
+	}).Info("Establishing gRPC connection ...")
 
-	// Check pool size
-	if pool.connCount >= uint32(pool.options.MaxCap) {
-		pool.mutex.Unlock()
-		return pool.connCount, ErrExceeded
+	// Preparing context with timeout options
+	if pool.options.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pool.options.DialTimeout)
+		defer cancel()
 	}
 
-	// Update counter
-	pool.connCount++
+	return grpc.DialContext(ctx, pool.host, pool.dialOptions...)
+}
 
-	pool.mutex.Unlock()
+// Get takes a connection, it waits for connection returned by others if maximum is reached
+func (pool *GRPCPool) Get(ctx context.Context) (*grpc.ClientConn, error) {
 
-	return pool.connCount, nil
-}
+	for {
 
-func (pool *GRPCPool) unref() (uint32, error) {
-	pool.mutex.Lock()
-	pool.connCount--
-	pool.mutex.Unlock()
+		pool.mutex.Lock()
 
-	return pool.connCount, nil
-}
+		if pool.closed {
+			pool.mutex.Unlock()
+			return nil, ErrClosed
+		}
 
-func (pool *GRPCPool) factory() (*grpc.ClientConn, error) {
+		// Take the most recently used connection
+		if n := len(pool.idle); n > 0 {
+			c := pool.idle[n-1]
+			pool.idle = pool.idle[:n-1]
 
-	count, err := pool.ref()
-	if err != nil {
-		return nil, ErrExceeded
+			if !c.isHealthy() {
+				pool.discardLocked(c)
+				pool.mutex.Unlock()
+				continue
+			}
+
+			pool.inUse++
+			pool.mutex.Unlock()
+
+			return c.connection, nil
+		}
+
+		// Create a new connection
+		if pool.open < pool.options.MaxCap {
+			pool.open++
+			pool.inUse++
+			pool.mutex.Unlock()
+
+			connection, err := pool.factory(ctx)
+			if err != nil {
+				pool.mutex.Lock()
+				pool.open--
+				pool.inUse--
+				pool.dialFailures++
+				pool.notifyLocked()
+				pool.mutex.Unlock()
+
+				return nil, err
+			}
+
+			return connection, nil
+		}
+
+		// Waiting for connection
+		w := make(waiter, 1)
+		ele := pool.waiters.PushBack(w)
+		pool.waitCount++
+		pool.mutex.Unlock()
+
+		select {
+		case c := <-w:
+			if c == nil {
+				continue
+			}
+
+			return c.connection, nil
+		case <-ctx.Done():
+		}
+
+		// Notification might be delivered at the same time, it is passed to others
+		var delivered *Connection
+		pool.mutex.Lock()
+		pool.waiters.Remove(ele)
+		select {
+		case c := <-w:
+			if c == nil {
+				pool.notifyLocked()
+			}
+
+			delivered = c
+		default:
+		}
+		pool.mutex.Unlock()
+
+		if delivered != nil {
+			pool.Put(delivered.connection)
+		}
+
+		return nil, ctx.Err()
 	}
+}
 
-	log.WithFields(log.Fields{
-		"count": count,
-	}).Info("Establishing gRPC connection ...")
+// Put returns connection to pool, it is given to waiting caller directly
+func (pool *GRPCPool) Put(connection *grpc.ClientConn) error {
 
-	// Preparing context with timeout options
-	ctx, cancel := context.WithTimeout(context.Background(), pool.options.DialTimeout)
-	defer cancel()
+	c := NewConnection(connection)
 
-	connection, err := grpc.DialContext(ctx, pool.host, pool.dialOptions...)
-	if err != nil {
-		pool.unref()
-		return nil, err
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	pool.inUse--
+
+	if pool.closed || !c.isHealthy() {
+		pool.discardLocked(c)
+		pool.checkDrainedLocked()
+		return nil
 	}
 
-	return connection, nil
-}
+	if ele := pool.waiters.Front(); ele != nil {
+		pool.waiters.Remove(ele)
+		pool.inUse++
+		ele.Value.(waiter) <- c
+		return nil
+	}
+
+	pool.idle = append(pool.idle, c)
 
-func (pool *GRPCPool) checkConnectionState(connection *grpc.ClientConn) bool {
+	return nil
+}
 
-	state := connection.GetState()
+// discardLocked closes connection and lets waiting caller create a new one
+func (pool *GRPCPool) discardLocked(c *Connection) {
 
-	if state == connectivity.Shutdown || state == connectivity.TransientFailure {
+	c.connection.Close()
+	pool.open--
+	pool.notifyLocked()
+}
 
-		// this connection doesn't work
-		connection.Close()
-		/*
-			pool.mutex.Lock()
-			pool.connCount--
-			pool.mutex.Unlock()
-		*/
-		pool.unref()
+func (pool *GRPCPool) notifyLocked() {
 
-		return false
+	if ele := pool.waiters.Front(); ele != nil {
+		pool.waiters.Remove(ele)
+		ele.Value.(waiter) <- nil
 	}
+}
 
-	return true
+func (pool *GRPCPool) checkDrainedLocked() {
+
+	if pool.closed && pool.inUse == 0 {
+		select {
+		case <-pool.drained:
+		default:
+			close(pool.drained)
+		}
+	}
 }
 
-func (pool *GRPCPool) Get() (*grpc.ClientConn, error) {
+// evict closes connections which are unhealthy or idle for too long, InitCap connections are kept
+func (pool *GRPCPool) evict() {
 
-	pool.mutex.Lock()
-	connections := pool.connections
-	pool.mutex.Unlock()
+	interval := pool.options.IdleTimeout / 2
+	if interval <= 0 || interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
 
-	for {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
+	for {
 		select {
-		case c := <-connections:
-			// Getting connection from buffered channel
+		case <-pool.done:
+			return
+		case <-ticker.C:
+		}
 
-			if !pool.checkConnectionState(c.connection) {
-				continue
-			}
+		pool.mutex.Lock()
 
-			return c.connection, nil
-		default:
+		idle := make([]*Connection, 0, len(pool.idle))
+		for _, c := range pool.idle {
 
-			// No available connection, so creating a new connection
-			c, err := pool.factory()
-			if err != nil {
-				log.Error(err)
+			if c.isHealthy() && (!c.isIdle(pool.options.IdleTimeout) || pool.open <= pool.options.InitCap) {
+				idle = append(idle, c)
 				continue
 			}
 
-			pool.Put(c)
+			pool.discardLocked(c)
+			pool.evicted++
 		}
+
+		pool.idle = idle
+
+		pool.mutex.Unlock()
 	}
 }
 
-func (pool *GRPCPool) Put(connection *grpc.ClientConn) error {
+// Stats returns statistics of pool
+func (pool *GRPCPool) Stats() *Stats {
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	return &Stats{
+		Open:         pool.open,
+		Idle:         len(pool.idle),
+		InUse:        pool.inUse,
+		Waiting:      pool.waiters.Len(),
+		DialFailures: pool.dialFailures,
+		WaitCount:    pool.waitCount,
+		Evicted:      pool.evicted,
+	}
+}
 
-	if !pool.checkConnectionState(connection) {
+// Close stops taking connections and waits for connections in use until context is done
+func (pool *GRPCPool) Close(ctx context.Context) error {
+
+	pool.mutex.Lock()
+
+	if pool.closed {
+		pool.mutex.Unlock()
 		return nil
 	}
 
-	pool.connections <- NewConnection(connection)
-	return nil
+	pool.closed = true
+	close(pool.done)
+
+	// Waiting callers will find out pool is closed
+	for pool.waiters.Len() > 0 {
+		pool.notifyLocked()
+	}
+
+	for _, c := range pool.idle {
+		c.connection.Close()
+		pool.open--
+	}
+
+	pool.idle = nil
+	pool.checkDrainedLocked()
+
+	pool.mutex.Unlock()
+
+	select {
+	case <-pool.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
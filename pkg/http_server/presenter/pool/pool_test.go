@@ -0,0 +1,378 @@
+package pool
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func newTestPool(t *testing.T, options *Options) *GRPCPool {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := grpc.NewServer()
+	go server.Serve(listener)
+
+	pool, err := NewGRPCPool(listener.Addr().String(), options, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		pool.Close(ctx)
+		server.Stop()
+	})
+
+	return pool
+}
+
+func testOptions(maxCap int) *Options {
+	return &Options{
+		InitCap:     0,
+		MaxCap:      maxCap,
+		DialTimeout: time.Second,
+		IdleTimeout: time.Minute,
+	}
+}
+
+func TestPoolInitCap(t *testing.T) {
+
+	options := testOptions(2)
+	options.InitCap = 4
+
+	pool := newTestPool(t, options)
+
+	stats := pool.Stats()
+	if stats.Open != 2 || stats.Idle != 2 {
+		t.Errorf("open = %d, idle = %d, want 2 connections which are limited by MaxCap", stats.Open, stats.Idle)
+	}
+}
+
+func TestPoolMaxCap(t *testing.T) {
+
+	pool := newTestPool(t, testOptions(2))
+
+	for i := 0; i < 2; i++ {
+		connection, err := pool.Get(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer pool.Put(connection)
+	}
+
+	// Waiting until deadline because all connections are in use
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := pool.Get(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Get returned after %v, before deadline", elapsed)
+	}
+
+	stats := pool.Stats()
+	if stats.Open != 2 || stats.InUse != 2 || stats.Waiting != 0 || stats.WaitCount != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPoolWaitForPut(t *testing.T) {
+
+	pool := newTestPool(t, testOptions(1))
+
+	connection, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := make(chan *grpc.ClientConn)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		c, err := pool.Get(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+
+		result <- c
+	}()
+
+	// Waiting caller takes the connection which is returned
+	for pool.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	pool.Put(connection)
+
+	c := <-result
+	if c != connection {
+		t.Error("waiting caller didn't get the returned connection")
+	}
+
+	defer pool.Put(c)
+
+	stats := pool.Stats()
+	if stats.Open != 1 || stats.InUse != 1 || stats.Idle != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPoolWaiterExpiredWithNotification(t *testing.T) {
+
+	pool := newTestPool(t, testOptions(1))
+
+	connection, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(ctx context.Context, result chan error) {
+		c, err := pool.Get(ctx)
+		if err == nil {
+			defer pool.Put(c)
+		}
+
+		result <- err
+	}
+
+	// Short-lived waiter is the first one
+	short, cancelShort := context.WithCancel(context.Background())
+	shortResult := make(chan error, 1)
+	go wait(short, shortResult)
+
+	for pool.Stats().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	long, cancelLong := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelLong()
+
+	longResult := make(chan error, 1)
+	go wait(long, longResult)
+
+	for pool.Stats().Waiting != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Short-lived waiter expires while it is notified that connection is discarded
+	pool.mutex.Lock()
+	cancelShort()
+	time.Sleep(20 * time.Millisecond)
+	pool.inUse--
+	pool.discardLocked(NewConnection(connection))
+	pool.mutex.Unlock()
+
+	if err := <-shortResult; err != context.Canceled {
+		t.Errorf("error of short-lived waiter = %v, want %v", err, context.Canceled)
+	}
+
+	// Notification is passed to long-lived waiter which creates a new connection
+	if err := <-longResult; err != nil {
+		t.Errorf("error of long-lived waiter = %v, notification is lost", err)
+	}
+}
+
+func TestPoolDiscardUnhealthy(t *testing.T) {
+
+	pool := newTestPool(t, testOptions(1))
+
+	connection, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Connection which is shut down is not returned to pool
+	connection.Close()
+	pool.Put(connection)
+
+	stats := pool.Stats()
+	if stats.Open != 0 || stats.Idle != 0 || stats.InUse != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// Idle connection which becomes unhealthy is replaced
+	connection, err = pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Put(connection)
+	connection.Close()
+
+	c, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c == connection {
+		t.Error("unhealthy connection is taken from pool")
+	}
+
+	defer pool.Put(c)
+
+	stats = pool.Stats()
+	if stats.Open != 1 || stats.InUse != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPoolEvict(t *testing.T) {
+
+	options := testOptions(2)
+	options.IdleTimeout = 20 * time.Millisecond
+
+	pool := newTestPool(t, options)
+
+	a, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Put(a)
+	pool.Put(b)
+
+	// Both idle connections are evicted because InitCap is zero
+	deadline := time.Now().Add(time.Second)
+	for pool.Stats().Evicted < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("idle connections were not evicted, stats = %+v", pool.Stats())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	stats := pool.Stats()
+	if stats.Open != 0 || stats.Idle != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPoolEvictUnhealthy(t *testing.T) {
+
+	options := testOptions(2)
+	options.InitCap = 2
+	options.IdleTimeout = 20 * time.Millisecond
+
+	pool := newTestPool(t, options)
+
+	connection, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.Put(connection)
+	connection.Close()
+
+	// Connections of InitCap are kept unless they are unhealthy
+	deadline := time.Now().Add(time.Second)
+	for pool.Stats().Evicted < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("unhealthy connection was not evicted, stats = %+v", pool.Stats())
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	stats := pool.Stats()
+	if stats.Open != 1 || stats.Idle != 1 || stats.Evicted != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPoolCloseDrains(t *testing.T) {
+
+	pool := newTestPool(t, testOptions(1))
+
+	connection, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiting caller is released by Close
+	waitErr := make(chan error)
+	go func() {
+		_, err := pool.Get(context.Background())
+		waitErr <- err
+	}()
+
+	for pool.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan error)
+	go func() {
+		closed <- pool.Close(context.Background())
+	}()
+
+	if err := <-waitErr; err != ErrClosed {
+		t.Errorf("error of waiting caller = %v, want %v", err, ErrClosed)
+	}
+
+	// Close waits for connection in use
+	select {
+	case <-closed:
+		t.Fatal("Close returned while connection is in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	pool.Put(connection)
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return after connection was returned")
+	}
+
+	if _, err := pool.Get(context.Background()); err != ErrClosed {
+		t.Errorf("error = %v, want %v", err, ErrClosed)
+	}
+
+	stats := pool.Stats()
+	if stats.Open != 0 || stats.InUse != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPoolCloseTimeout(t *testing.T) {
+
+	pool := newTestPool(t, testOptions(1))
+
+	connection, err := pool.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := pool.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	pool.Put(connection)
+}
@@ -1,9 +1,12 @@
 package presenter
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/BrobridgeOrg/gravity-presenter-rest/pkg/http_server"
 	log "github.com/sirupsen/logrus"
@@ -12,34 +15,127 @@ import (
 
 type Presenter struct {
 	server       http_server.Server
-	endpoints    map[string]*Endpoint
-	queryAdapter *QueryAdapter
+	router       *Router
+	watcher      *Watcher
+	dataSources  *DataSources
+	settingsPath string
+
+	mutex sync.Mutex
 }
 
 func NewPresenter(server http_server.Server) *Presenter {
 	return &Presenter{
-		server:       server,
-		endpoints:    make(map[string]*Endpoint),
-		queryAdapter: NewQueryAdapter(),
+		server:      server,
+		router:      NewRouter(),
+		dataSources: NewDataSources(),
 	}
 }
 
 func (presenter *Presenter) Init() error {
 
-	// Initialize query adapter
-	err := presenter.queryAdapter.Init()
+	// Initialize data sources
+	err := presenter.dataSources.Init()
 	if err != nil {
 		return err
 	}
 
 	// Initialize endpoints
-	settingsPath := viper.GetString("service.settingsPath")
+	presenter.settingsPath = viper.GetString("service.settingsPath")
 
 	log.WithFields(log.Fields{
-		"path": settingsPath,
+		"path": presenter.settingsPath,
 	}).Info("Loading settings")
 
-	err = filepath.Walk(settingsPath, func(path string, info os.FileInfo, err error) error {
+	err = presenter.Reload()
+	if err != nil {
+		return err
+	}
+
+	// Routes are dispatched to the latest route table
+	presenter.server.GetEngine().NoRoute(presenter.router.Handle)
+
+	// Serving API documentation
+	err = presenter.initOpenAPI()
+	if err != nil {
+		return err
+	}
+
+	// Serving statistics
+	presenter.initMetrics()
+
+	// Watching settings for changes
+	if viper.GetBool("service.hotReload") {
+		presenter.watcher = NewWatcher(presenter)
+		err = presenter.watcher.Watch(presenter.settingsPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (presenter *Presenter) Uninit(ctx context.Context) {
+
+	if presenter.watcher != nil {
+		presenter.watcher.Close()
+	}
+
+	// Connections are closed after queries in progress are completed
+	presenter.dataSources.Close(ctx)
+}
+
+// loadFuncs prepares functions for templates, including functions written in JavaScript
+func (presenter *Presenter) loadFuncs(settingsPath string) (map[string]interface{}, error) {
+
+	sf := NewScriptFunctions()
+	err := sf.Load(settingsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := templateFuncs()
+	for name, fn := range sf.Funcs() {
+
+		if _, ok := funcs[name]; ok || templateBuiltins[name] {
+			return nil, fmt.Errorf("Template function \"%s\" is already defined", name)
+		}
+
+		funcs[name] = fn
+	}
+
+	return funcs, nil
+}
+
+func (presenter *Presenter) loadSettings(settingsPath string) (map[string]*Endpoint, map[string]*StateDefinition, error) {
+
+	funcs, err := presenter.loadFuncs(settingsPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	states, err := loadGlobalStates(settingsPath, funcs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endpoints, err := presenter.loadEndpoints(settingsPath, states, funcs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return endpoints, states, nil
+}
+
+func (presenter *Presenter) loadEndpoints(settingsPath string, states map[string]*StateDefinition, funcs map[string]interface{}) (map[string]*Endpoint, error) {
+
+	endpoints := make(map[string]*Endpoint)
+
+	err := filepath.Walk(settingsPath, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
 
 		// Ignore directory
 		if info.IsDir() {
@@ -57,22 +153,46 @@ func (presenter *Presenter) Init() error {
 		// Create endpoint
 		endpointName := strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
 		endpoint := NewEndpoint(presenter, endpointName)
+		endpoint.global = states
+		endpoint.funcs = funcs
 		if err := endpoint.Load(path); err != nil {
 			return err
 		}
 
-		if err := endpoint.Register(); err != nil {
-			return err
-		}
-
-		presenter.endpoints[endpointName] = endpoint
+		endpoints[endpointName] = endpoint
 
 		return nil
 	})
 
+	if err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// Reload loads all endpoints from settings path and replaces the current route table.
+// The current route table keeps serving if anything goes wrong.
+func (presenter *Presenter) Reload() error {
+
+	presenter.mutex.Lock()
+	defer presenter.mutex.Unlock()
+
+	endpoints, states, err := presenter.loadSettings(presenter.settingsPath)
+	if err != nil {
+		return err
+	}
+
+	table, err := NewRouteTable(endpoints, states)
 	if err != nil {
 		return err
 	}
 
+	presenter.router.Swap(table)
+
+	log.WithFields(log.Fields{
+		"endpoints": len(endpoints),
+	}).Info("Endpoints were loaded")
+
 	return nil
 }
@@ -0,0 +1,157 @@
+package presenter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const usersEndpoint = `{
+	"method": "get",
+	"uri": "/users",
+	"query": { "table": "accounts" },
+	"response": {
+		"state": {
+			"success": { "template": "users.tmpl" }
+		}
+	}
+}`
+
+func writeSetting(t *testing.T, presenter *Presenter, name string, content string) {
+
+	filename := filepath.Join(presenter.settingsPath, name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReload(t *testing.T) {
+
+	presenter := newTestPresenter(t, map[string]string{
+		"accounts.json": headEndpoint,
+	}, map[string]string{
+		"accounts.json": `[{ "id": 1, "name": "alice" }]`,
+	})
+
+	table := presenter.router.GetTable()
+
+	get := func(path string) int {
+		return serveTest(presenter, httptest.NewRequest(http.MethodGet, path, nil)).Code
+	}
+
+	if code := get("/accounts"); code != http.StatusOK {
+		t.Fatalf("code = %d, want %d", code, http.StatusOK)
+	}
+
+	// Broken settings don't replace route table
+	broken := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"invalid JSON", map[string]string{"users.json": `{ "method": "get", `}},
+		{"missing template", map[string]string{"users.json": usersEndpoint}},
+		{"invalid template", map[string]string{"users.json": usersEndpoint, "users.tmpl": `{{ range .Records }}`}},
+		{"conflicting route", map[string]string{"users.json": headEndpoint}},
+		{"unknown data source", map[string]string{"users.json": `{ "method": "get", "uri": "/users", "query": { "table": "accounts", "source": "missing" } }`}},
+		{"invalid script", map[string]string{"funcs.js": `function (`}},
+	}
+
+	for _, test := range broken {
+		t.Run(test.name, func(t *testing.T) {
+
+			for name, content := range test.files {
+				writeSetting(t, presenter, name, content)
+				defer os.Remove(filepath.Join(presenter.settingsPath, name))
+			}
+
+			if err := presenter.Reload(); err == nil {
+				t.Fatal("broken settings are loaded")
+			}
+
+			if presenter.router.GetTable() != table {
+				t.Fatal("route table is replaced")
+			}
+
+			if code := get("/accounts"); code != http.StatusOK {
+				t.Errorf("code = %d, want %d", code, http.StatusOK)
+			}
+
+			if code := get("/users"); code != http.StatusNotFound {
+				t.Errorf("code of /users = %d, want %d", code, http.StatusNotFound)
+			}
+		})
+	}
+
+	// Good settings replace route table
+	writeSetting(t, presenter, "users.json", usersEndpoint)
+	writeSetting(t, presenter, "users.tmpl", `{{ len .Records }}`)
+
+	if err := presenter.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if presenter.router.GetTable() == table {
+		t.Fatal("route table is not replaced")
+	}
+
+	for _, path := range []string{"/accounts", "/users"} {
+		if code := get(path); code != http.StatusOK {
+			t.Errorf("code of %s = %d, want %d", path, code, http.StatusOK)
+		}
+	}
+
+	// Previous route table keeps serving requests which arrived before
+	w := httptest.NewRecorder()
+	table.engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("code of previous route table = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+
+	presenter := newTestPresenter(t, map[string]string{
+		"accounts.json": headEndpoint,
+	}, map[string]string{
+		"accounts.json": `[{ "id": 1, "name": "alice" }]`,
+	})
+
+	watcher := NewWatcher(presenter)
+	if err := watcher.Watch(presenter.settingsPath); err != nil {
+		t.Skip(err)
+	}
+
+	defer watcher.Close()
+
+	table := presenter.router.GetTable()
+
+	// Endpoint is added to a new directory
+	dir := filepath.Join(presenter.settingsPath, "users")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	writeSetting(t, presenter, "users/users.tmpl", `{{ len .Records }}`)
+	writeSetting(t, presenter, "users/users.json", usersEndpoint)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for presenter.router.GetTable() == table {
+
+		if time.Now().After(deadline) {
+			t.Fatal("route table is not reloaded")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	w := serveTest(presenter, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "1" {
+		t.Errorf("code = %d, body = %s", w.Code, w.Body.String())
+	}
+}
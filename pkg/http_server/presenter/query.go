@@ -1,13 +1,12 @@
 package presenter
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
-	"encoding/gob"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/BrobridgeOrg/gravity-presenter-rest/pkg/http_server/presenter/pool"
@@ -18,11 +17,7 @@ import (
 	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
 )
 
-var (
-	NotUnsignedIntegerErr = errors.New("Not unisgned integer")
-	NotIntegerErr         = errors.New("Not integer")
-	NotFloatErr           = errors.New("Not float")
-)
+var ErrScanLimitExceeded = errors.New("Too many records to be filtered")
 
 type QueryOption struct {
 	Limit      int64
@@ -31,42 +26,89 @@ type QueryOption struct {
 	Descending bool
 }
 
+type QueryStats struct {
+	*FlightStats
+	Retries  uint64          `json:"retries"`
+	Breaker  *BreakerStats   `json:"breaker"`
+	Replicas []*ReplicaStats `json:"replicas"`
+}
+
 type QueryAdapter struct {
-	pool *pool.GRPCPool
+	retries  uint64
+	replicas *ReplicaSet
+	flights  *FlightGroup
+	timeout  time.Duration
+	maxScan  int64
+	retry    *RetryPolicy
+	breaker  *CircuitBreaker
 }
 
 func NewQueryAdapter() *QueryAdapter {
-	return &QueryAdapter{}
+	return &QueryAdapter{
+		flights: NewFlightGroup(),
+	}
 }
 
-func (adapter *QueryAdapter) Init() error {
+// Init connects to querykit with settings of specific section in config file
+func (adapter *QueryAdapter) Init(section string) error {
+
+	setting := func(name string) string {
+		return section + "." + name
+	}
 
 	// Initialize connection pool
-	host := fmt.Sprintf("%s:%d", viper.GetString("querykit.host"), viper.GetInt("querykit.port"))
+	viper.SetDefault(setting("pool.initCap"), 8)
+	viper.SetDefault(setting("pool.maxCap"), 16)
+	viper.SetDefault(setting("pool.dialTimeout"), "20s")
+	viper.SetDefault(setting("pool.idleTimeout"), "60s")
+
 	options := &pool.Options{
-		InitCap:     8,
-		MaxCap:      16,
-		DialTimeout: time.Second * 20,
-		IdleTimeout: time.Second * 60,
+		InitCap:     viper.GetInt(setting("pool.initCap")),
+		MaxCap:      viper.GetInt(setting("pool.maxCap")),
+		DialTimeout: viper.GetDuration(setting("pool.dialTimeout")),
+		IdleTimeout: viper.GetDuration(setting("pool.idleTimeout")),
 	}
 
-	p, err := pool.NewGRPCPool(host, options, grpc.WithInsecure())
+	// Connect to replicas of querykit
+	replicas := NewReplicaSet(section, options)
+	err := replicas.Init()
 	if err != nil {
 		return err
 	}
 
-	if p == nil {
-		return err
+	adapter.replicas = replicas
+
+	// Default timeout of queries
+	adapter.timeout = viper.GetDuration(setting("timeout"))
+
+	// Maximum number of records which are filtered by presenter for a query
+	viper.SetDefault(setting("maxScan"), 10000)
+	adapter.maxScan = viper.GetInt64(setting("maxScan"))
+
+	// Retries and circuit breaker for failures of querykit
+	viper.SetDefault(setting("retry.attempts"), 3)
+	viper.SetDefault(setting("retry.initialBackoff"), "100ms")
+	viper.SetDefault(setting("retry.maxBackoff"), "2s")
+	viper.SetDefault(setting("breaker.threshold"), 5)
+	viper.SetDefault(setting("breaker.cooldown"), "30s")
+
+	adapter.retry = &RetryPolicy{
+		Attempts:       viper.GetInt(setting("retry.attempts")),
+		InitialBackoff: viper.GetDuration(setting("retry.initialBackoff")),
+		MaxBackoff:     viper.GetDuration(setting("retry.maxBackoff")),
 	}
 
-	adapter.pool = p
+	adapter.breaker = NewCircuitBreaker(
+		viper.GetInt(setting("breaker.threshold")),
+		viper.GetDuration(setting("breaker.cooldown")),
+	)
 
 	return nil
 }
 
 func (adapter *QueryAdapter) prepareCondition(condition *Condition) (*querykit.Condition, error) {
 
-	v, err := adapter.getValue(condition.Value)
+	v, err := EncodeValue(condition.Value)
 	if err != nil {
 		return nil, err
 	}
@@ -77,24 +119,27 @@ func (adapter *QueryAdapter) prepareCondition(condition *Condition) (*querykit.C
 		Conditions: make([]*querykit.Condition, 0, len(condition.Conditions)),
 	}
 
-	if condition.Operator == "&&" {
+	switch condition.Operator {
+	case "&&":
 		qCondition.Operator = querykit.Operator_AND
-	} else if condition.Operator == "||" {
+	case "||":
 		qCondition.Operator = querykit.Operator_OR
-	} else if condition.Operator == ">" {
+	case ">":
 		qCondition.Operator = querykit.Operator_GREATER_THAN
-	} else if condition.Operator == ">=" {
+	case ">=":
 		qCondition.Operator = querykit.Operator_GREATER_EQUAL
-	} else if condition.Operator == "<" {
+	case "<":
 		qCondition.Operator = querykit.Operator_LESS_THAN
-	} else if condition.Operator == "<=" {
+	case "<=":
 		qCondition.Operator = querykit.Operator_LESS_EQUAL
-	} else if condition.Operator == "!=" {
+	case "!=":
 		qCondition.Operator = querykit.Operator_NOT_EQUAL
-	} else if condition.Operator == "isExist" {
+	case "isExist":
 		qCondition.Operator = querykit.Operator_IS_EXIST
-	} else {
+	case "", "=", "==":
 		qCondition.Operator = querykit.Operator_EQUAL
+	default:
+		return nil, fmt.Errorf("Operator \"%s\" is not supported by querykit", condition.Operator)
 	}
 
 	// Processing childs
@@ -110,15 +155,156 @@ func (adapter *QueryAdapter) prepareCondition(condition *Condition) (*querykit.C
 	return qCondition, nil
 }
 
-func (adapter *QueryAdapter) Query(table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+// Query sends request to querykit, identical queries in progress share the same call
+func (adapter *QueryAdapter) Query(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+
+	expanded, err := expandCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calls to querykit always have deadline
+	if _, ok := ctx.Deadline(); !ok && adapter.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, adapter.timeout)
+		defer cancel()
+	}
+
+	key, err := queryKey(table, expanded, option)
+	if err != nil {
+		return nil, err
+	}
+
+	return adapter.flights.Do(ctx, key, func(ctx context.Context) (*querykit.QueryReply, error) {
+		return adapter.filter(ctx, table, expanded, option)
+	})
+}
+
+// filter sends conditions which querykit supports, and the rest of conditions are evaluated by presenter
+func (adapter *QueryAdapter) filter(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+
+	if condition == nil {
+		return adapter.query(ctx, table, nil, option)
+	}
+
+	pushdown, residual := pushdownCondition(condition)
+
+	// Nothing matches, e.g. "in" with empty array
+	if isConstant(pushdown, "||") {
+		return &querykit.QueryReply{
+			Success: true,
+			Records: make([]*querykit.Record, 0),
+		}, nil
+	}
+
+	if isConstant(pushdown, "&&") {
+		pushdown = nil
+	}
+
+	if !residual {
+		return adapter.query(ctx, table, pushdown, option)
+	}
+
+	// Pagination is applied after records are filtered, and one more record is
+	// taken to find out whether the limit of scanning is exceeded
+	scanOption := &QueryOption{
+		OrderBy:    option.OrderBy,
+		Descending: option.Descending,
+	}
 
-	conn, err := adapter.pool.Get()
+	if adapter.maxScan > 0 {
+		scanOption.Limit = adapter.maxScan + 1
+	}
+
+	reply, err := adapter.query(ctx, table, pushdown, scanOption)
 	if err != nil {
 		return nil, err
 	}
 
-	client := querykit.NewQueryKitClient(conn)
-	adapter.pool.Put(conn)
+	if adapter.maxScan > 0 && int64(len(reply.Records)) > adapter.maxScan {
+		log.WithFields(log.Fields{
+			"table":   table,
+			"maxScan": adapter.maxScan,
+		}).Warn(ErrScanLimitExceeded)
+
+		return nil, ErrScanLimitExceeded
+	}
+
+	records := make([]*querykit.Record, 0, len(reply.Records))
+	for _, record := range reply.Records {
+		if matchCondition(decodeRecord(record), condition) {
+			records = append(records, record)
+		}
+	}
+
+	start, end := pageRange(len(records), option)
+
+	return &querykit.QueryReply{
+		Success: reply.Success,
+		Reason:  reply.Reason,
+		Records: records[start:end],
+	}, nil
+}
+
+// Timeout returns default timeout of queries
+func (adapter *QueryAdapter) Timeout() time.Duration {
+	return adapter.timeout
+}
+
+// Stats returns statistics of queries
+func (adapter *QueryAdapter) Stats() interface{} {
+	return &QueryStats{
+		FlightStats: adapter.flights.Stats(),
+		Retries:     atomic.LoadUint64(&adapter.retries),
+		Breaker:     adapter.breaker.Stats(),
+		Replicas:    adapter.replicas.Stats(),
+	}
+}
+
+// Close waits for queries in progress and closes connections
+func (adapter *QueryAdapter) Close(ctx context.Context) error {
+	return adapter.replicas.Close(ctx)
+}
+
+// query retries on transient errors until deadline of context
+func (adapter *QueryAdapter) query(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+
+	for attempt := 1; ; attempt++ {
+
+		generation, err := adapter.breaker.Allow()
+		if err != nil {
+			return nil, err
+		}
+
+		reply, err := adapter.call(ctx, table, condition, option)
+		adapter.breaker.Done(generation, callerError(ctx, err))
+		if err == nil {
+			return reply, nil
+		}
+
+		if !isTransient(err) || attempt >= adapter.retry.Attempts {
+			return nil, err
+		}
+
+		backoff := adapter.retry.Backoff(attempt - 1)
+
+		log.WithFields(log.Fields{
+			"table":   table,
+			"attempt": attempt,
+			"backoff": backoff,
+		}).Warn(err)
+
+		atomic.AddUint64(&adapter.retries, 1)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+func (adapter *QueryAdapter) call(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
 
 	// Preparing request
 	request := &querykit.QueryRequest{
@@ -177,198 +363,40 @@ func (adapter *QueryAdapter) Query(table string, condition *Condition, option *Q
 		}
 	*/
 
-	reply, err := client.Query(context.Background(), request)
-	if err != nil {
-		return nil, err
-	}
-
-	return reply, nil
-}
-
-func (adapter *QueryAdapter) getValue(data interface{}) (*querykit.Value, error) {
-
-	if data == nil {
-		return nil, nil
-		//		return nil, errors.New("data couldn't be nil")
-	}
-
-	// Float
-	bytes, err := adapter.getBytesFromFloat(data)
-	if err == nil {
-		return &querykit.Value{
-			Type:  querykit.DataType_FLOAT64,
-			Value: bytes,
-		}, nil
-	}
-
-	// Integer
-	bytes, err = adapter.getBytesFromInteger(data)
-	if err == nil {
-		return &querykit.Value{
-			Type:  querykit.DataType_INT64,
-			Value: bytes,
-		}, nil
-	}
-
-	// Unsigned integer
-	bytes, err = adapter.getBytesFromUnsignedInteger(data)
-	if err == nil {
-		return &querykit.Value{
-			Type:  querykit.DataType_INT64,
-			Value: bytes,
-		}, nil
-	}
-
-	v := reflect.ValueOf(data)
-
-	switch v.Kind() {
-	case reflect.Bool:
-		data, _ := adapter.getBytes(data)
-		return &querykit.Value{
-			Type:  querykit.DataType_BOOLEAN,
-			Value: data,
-		}, nil
-	case reflect.String:
-		return &querykit.Value{
-			Type:  querykit.DataType_STRING,
-			Value: []byte(data.(string)),
-		}, nil
-	case reflect.Map:
-
-		// Prepare map value
-		value := querykit.MapValue{
-			Fields: make([]*querykit.Field, 0),
-		}
-
-		// Convert each key-value set
-		for _, key := range v.MapKeys() {
-			ele := v.MapIndex(key)
-
-			// Convert value to protobuf format
-			v, err := adapter.getValue(ele.Interface())
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-
-			field := querykit.Field{
-				Name:  key.Interface().(string),
-				Value: v,
-			}
-
-			value.Fields = append(value.Fields, &field)
-		}
-
-		return &querykit.Value{
-			Type: querykit.DataType_MAP,
-			Map:  &value,
-		}, nil
-
-	case reflect.Slice:
-
-		// Prepare map value
-		value := querykit.ArrayValue{
-			Elements: make([]*querykit.Value, 0, v.Len()),
-		}
-
-		for i := 0; i < v.Len(); i++ {
-			ele := v.Index(i)
-
-			// Convert value to protobuf format
-			v, err := adapter.getValue(ele.Interface())
-			if err != nil {
-				log.Error(err)
-				continue
-			}
-
-			value.Elements = append(value.Elements, v)
-		}
+	var reply *querykit.QueryReply
+	err := adapter.replicas.Call(ctx, func(conn *grpc.ClientConn) error {
 
-		return &querykit.Value{
-			Type:  querykit.DataType_ARRAY,
-			Array: &value,
-		}, nil
+		client := querykit.NewQueryKitClient(conn)
 
-	default:
-		data, _ := adapter.getBytes(data)
-		return &querykit.Value{
-			Type:  querykit.DataType_BINARY,
-			Value: data,
-		}, nil
-	}
-}
+		var err error
+		reply, err = client.Query(ctx, request)
 
-func (adapter *QueryAdapter) getBytes(data interface{}) ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(data)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
-}
-
-func (adapter *QueryAdapter) getBytesFromUnsignedInteger(data interface{}) ([]byte, error) {
-
-	var buf = make([]byte, 8)
-
-	v := reflect.ValueOf(data)
-	switch v.Kind() {
-	case reflect.Uint:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(uint)))
-	case reflect.Uint8:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(uint8)))
-	case reflect.Uint16:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(uint16)))
-	case reflect.Uint32:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(uint32)))
-	case reflect.Uint64:
-		binary.LittleEndian.PutUint64(buf, data.(uint64))
-	default:
-		return nil, NotUnsignedIntegerErr
-	}
 
-	return buf, nil
+	return reply, nil
 }
 
-func (adapter *QueryAdapter) getBytesFromInteger(data interface{}) ([]byte, error) {
-
-	var buf = make([]byte, 8)
-
-	v := reflect.ValueOf(data)
-	switch v.Kind() {
-	case reflect.Int:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(int)))
-	case reflect.Int8:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(int8)))
-	case reflect.Int16:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(int16)))
-	case reflect.Int32:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(int32)))
-	case reflect.Int64:
-		binary.LittleEndian.PutUint64(buf, uint64(data.(int64)))
-	default:
-		return nil, NotIntegerErr
+// queryKey generates key of query with table, resolved conditions and query options
+func queryKey(table string, condition *Condition, option *QueryOption) (string, error) {
+
+	data, err := marshalJSON(struct {
+		Table     string
+		Condition *Condition
+		Option    *QueryOption
+	}{
+		Table:     table,
+		Condition: condition,
+		Option:    option,
+	})
+	if err != nil {
+		return "", err
 	}
 
-	return buf, nil
-}
-
-func (adapter *QueryAdapter) getBytesFromFloat(data interface{}) ([]byte, error) {
-	//var buf = make([]byte, 8)
-	var buf bytes.Buffer
-
-	v := reflect.ValueOf(data)
-	switch v.Kind() {
-	case reflect.Float32:
-		//binary.LittleEndian.PutUint64(buf, uint64(data.(float32)))
-		binary.Write(&buf, binary.LittleEndian, data)
-	case reflect.Float64:
-		//binary.LittleEndian.PutUint64(buf, uint64(data.(float64)))
-		binary.Write(&buf, binary.LittleEndian, data)
-	default:
-		return nil, NotFloatErr
-	}
+	sum := sha256.Sum256(data)
 
-	return buf.Bytes(), nil
+	return hex.EncodeToString(sum[:]), nil
 }
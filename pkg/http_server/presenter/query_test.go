@@ -0,0 +1,204 @@
+package presenter
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+type testQueryKit struct {
+	querykit.UnimplementedQueryKitServer
+
+	records []*querykit.Record
+	limits  []int64
+	mutex   sync.Mutex
+
+	// Queries wait until it is closed if it is set
+	block chan struct{}
+}
+
+func (server *testQueryKit) Query(ctx context.Context, req *querykit.QueryRequest) (*querykit.QueryReply, error) {
+
+	server.mutex.Lock()
+	server.limits = append(server.limits, req.Limit)
+	server.mutex.Unlock()
+
+	if server.block != nil {
+		<-server.block
+	}
+
+	records := server.records
+	if req.Limit > 0 && int64(len(records)) > req.Limit {
+		records = records[:req.Limit]
+	}
+
+	return &querykit.QueryReply{
+		Success: true,
+		Records: records,
+	}, nil
+}
+
+func newTestQueryAdapter(t *testing.T, section string, maxScan int, names ...string) (*QueryAdapter, *testQueryKit) {
+
+	server := &testQueryKit{
+		records: make([]*querykit.Record, 0, len(names)),
+	}
+
+	for _, name := range names {
+		value, err := EncodeValue(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		server.records = append(server.records, &querykit.Record{
+			Fields: []*querykit.Field{{Name: "name", Value: value}},
+		})
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := grpc.NewServer()
+	querykit.RegisterQueryKitServer(s, server)
+	go s.Serve(listener)
+
+	viper.Set(section+".addresses", []string{listener.Addr().String()})
+	viper.Set(section+".timeout", "1s")
+	viper.Set(section+".pool.initCap", 1)
+	viper.Set(section+".maxScan", maxScan)
+
+	adapter := NewQueryAdapter()
+	if err := adapter.Init(section); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		adapter.Close(context.Background())
+		s.Stop()
+	})
+
+	return adapter, server
+}
+
+func TestQueryResidualFilter(t *testing.T) {
+
+	adapter, server := newTestQueryAdapter(t, "scan_filter", 5, "alice", "bob", "carol", "dave")
+
+	condition := &Condition{Name: "name", Operator: "contains", Value: "a"}
+
+	reply, err := adapter.Query(context.Background(), "accounts", condition, &QueryOption{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alice, carol and dave are matched, and pagination is applied after filtering
+	names := make([]string, 0)
+	for _, record := range reply.Records {
+		names = append(names, decodeRecord(record)["name"].(string))
+	}
+
+	if fmt.Sprint(names) != "[carol dave]" {
+		t.Errorf("records = %v, want [carol dave]", names)
+	}
+
+	// Scanning is limited, and one more record tells whether limit is exceeded
+	if fmt.Sprint(server.limits) != "[6]" {
+		t.Errorf("limits of querykit = %v, want [6]", server.limits)
+	}
+}
+
+func TestQueryResidualFilterExceeded(t *testing.T) {
+
+	adapter, _ := newTestQueryAdapter(t, "scan_exceeded", 3, "alice", "bob", "carol", "dave")
+
+	condition := &Condition{Name: "name", Operator: "contains", Value: "a"}
+
+	_, err := adapter.Query(context.Background(), "accounts", condition, &QueryOption{})
+	if err != ErrScanLimitExceeded {
+		t.Errorf("error = %v, want %v", err, ErrScanLimitExceeded)
+	}
+}
+
+func TestQueryResidualFilterUnlimited(t *testing.T) {
+
+	adapter, server := newTestQueryAdapter(t, "scan_unlimited", 0, "alice", "bob", "carol", "dave")
+
+	condition := &Condition{Name: "name", Operator: "contains", Value: "o"}
+
+	reply, err := adapter.Query(context.Background(), "accounts", condition, &QueryOption{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reply.Records) != 2 {
+		t.Errorf("records = %d, want 2", len(reply.Records))
+	}
+
+	if fmt.Sprint(server.limits) != "[0]" {
+		t.Errorf("limits of querykit = %v, want [0]", server.limits)
+	}
+}
+
+func TestQueryStartsWithPushdown(t *testing.T) {
+
+	adapter, server := newTestQueryAdapter(t, "scan_prefix", 3, "alice", "bob", "carol", "dave")
+
+	condition := &Condition{Name: "name", Operator: "startsWith", Value: "a"}
+
+	// Range of prefix is evaluated by querykit, so records are neither scanned nor limited by maxScan
+	_, err := adapter.Query(context.Background(), "accounts", condition, &QueryOption{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fmt.Sprint(server.limits) != "[2]" {
+		t.Errorf("limits of querykit = %v, want [2]", server.limits)
+	}
+}
+
+func TestQueryCoalescing(t *testing.T) {
+
+	const n = 8
+
+	adapter, server := newTestQueryAdapter(t, "query_coalescing", 0, "alice", "bob")
+	server.block = make(chan struct{})
+
+	condition := &Condition{Name: "name", Operator: "=", Value: "alice"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if _, err := adapter.Query(context.Background(), "accounts", condition, &QueryOption{Limit: 10}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	for adapter.flights.Stats().Coalesced < n-1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(server.block)
+	wg.Wait()
+
+	// Identical queries at the same time are sent to querykit once
+	if len(server.limits) != 1 {
+		t.Errorf("queries of querykit = %d, want 1", len(server.limits))
+	}
+
+	if stats := adapter.flights.Stats(); stats.Calls != 1 || stats.Coalesced != n-1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,479 @@
+package presenter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-presenter-rest/pkg/http_server/presenter/pool"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+var ErrNoReplica = errors.New("No replica of querykit is available")
+
+const (
+	BALANCER_ROUND_ROBIN       = "round_robin"
+	BALANCER_LEAST_OUTSTANDING = "least_outstanding"
+)
+
+// Replica is one querykit server with its own connection pool
+type Replica struct {
+	address string
+	pool    *pool.GRPCPool
+
+	outstanding int64
+	requests    uint64
+	failures    uint64
+	ejections   uint64
+
+	consecutive  int
+	ejectedUntil time.Time
+	mutex        sync.Mutex
+}
+
+type ReplicaStats struct {
+	Address     string      `json:"address"`
+	Healthy     bool        `json:"healthy"`
+	Outstanding int64       `json:"outstanding"`
+	Requests    uint64      `json:"requests"`
+	Failures    uint64      `json:"failures"`
+	Ejections   uint64      `json:"ejections"`
+	Pool        *pool.Stats `json:"pool"`
+}
+
+func (replica *Replica) healthy(now time.Time) bool {
+
+	replica.mutex.Lock()
+	defer replica.mutex.Unlock()
+
+	return !now.Before(replica.ejectedUntil)
+}
+
+func (replica *Replica) begin() {
+	atomic.AddInt64(&replica.outstanding, 1)
+	atomic.AddUint64(&replica.requests, 1)
+}
+
+// done records result of call, replica is ejected after consecutive failures
+func (replica *Replica) done(err error, threshold int, ejectTime time.Duration) {
+
+	atomic.AddInt64(&replica.outstanding, -1)
+
+	replica.mutex.Lock()
+	defer replica.mutex.Unlock()
+
+	if err == nil {
+		replica.consecutive = 0
+		return
+	}
+
+	// Errors which are not caused by server are ignored
+	if !isServerFailure(err) {
+		return
+	}
+
+	replica.failures++
+	replica.consecutive++
+
+	if threshold <= 0 || replica.consecutive < threshold {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"address":  replica.address,
+		"failures": replica.consecutive,
+		"duration": ejectTime,
+	}).Warn("Ejecting replica of querykit")
+
+	replica.consecutive = 0
+	replica.ejections++
+	replica.ejectedUntil = time.Now().Add(ejectTime)
+}
+
+func (replica *Replica) Stats() *ReplicaStats {
+
+	replica.mutex.Lock()
+	failures := replica.failures
+	ejections := replica.ejections
+	replica.mutex.Unlock()
+
+	return &ReplicaStats{
+		Address:     replica.address,
+		Healthy:     replica.healthy(time.Now()),
+		Outstanding: atomic.LoadInt64(&replica.outstanding),
+		Requests:    atomic.LoadUint64(&replica.requests),
+		Failures:    failures,
+		Ejections:   ejections,
+		Pool:        replica.pool.Stats(),
+	}
+}
+
+// ReplicaSet balances calls across replicas of a data source, which are static or resolved by DNS
+type ReplicaSet struct {
+	section  string
+	options  *pool.Options
+	balancer string
+
+	// Discovery by DNS
+	discovery string
+	name      string
+	port      int
+	refresh   time.Duration
+
+	// Ejection of failing replicas
+	threshold int
+	ejectTime time.Duration
+
+	replicas []*Replica
+	next     uint64
+	done     chan struct{}
+	mutex    sync.RWMutex
+}
+
+func NewReplicaSet(section string, options *pool.Options) *ReplicaSet {
+	return &ReplicaSet{
+		section:  section,
+		options:  options,
+		replicas: make([]*Replica, 0),
+		done:     make(chan struct{}),
+	}
+}
+
+// Init connects to replicas with settings of data source
+func (rs *ReplicaSet) Init() error {
+
+	setting := func(name string) string {
+		return rs.section + "." + name
+	}
+
+	viper.SetDefault(setting("balancer"), BALANCER_ROUND_ROBIN)
+	viper.SetDefault(setting("discovery.refresh"), "30s")
+	viper.SetDefault(setting("health.failures"), 3)
+	viper.SetDefault(setting("health.ejectTime"), "30s")
+
+	rs.balancer = viper.GetString(setting("balancer"))
+	switch rs.balancer {
+	case BALANCER_ROUND_ROBIN, BALANCER_LEAST_OUTSTANDING:
+	default:
+		return fmt.Errorf("Unknown balancer \"%s\"", rs.balancer)
+	}
+
+	rs.discovery = viper.GetString(setting("discovery.type"))
+	rs.name = viper.GetString(setting("discovery.name"))
+	rs.port = viper.GetInt(setting("port"))
+	rs.refresh = viper.GetDuration(setting("discovery.refresh"))
+	rs.threshold = viper.GetInt(setting("health.failures"))
+	rs.ejectTime = viper.GetDuration(setting("health.ejectTime"))
+
+	switch rs.discovery {
+	case "":
+	case "srv", "a":
+		if len(rs.name) == 0 {
+			return errors.New("Required name for DNS discovery")
+		}
+	default:
+		return fmt.Errorf("Unknown discovery type \"%s\"", rs.discovery)
+	}
+
+	targets, err := rs.resolve(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if len(targets) == 0 {
+		return ErrNoReplica
+	}
+
+	err = rs.update(targets)
+	if err != nil {
+		return err
+	}
+
+	if len(rs.discovery) > 0 && rs.refresh > 0 {
+		go rs.watch()
+	}
+
+	return nil
+}
+
+// resolve returns addresses of replicas with host names for verification of TLS
+func (rs *ReplicaSet) resolve(ctx context.Context) (map[string]string, error) {
+
+	targets := make(map[string]string)
+
+	switch rs.discovery {
+	case "srv":
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", rs.name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Target, ".")
+			targets[net.JoinHostPort(host, strconv.Itoa(int(record.Port)))] = host
+		}
+	case "a":
+		addrs, err := net.DefaultResolver.LookupHost(ctx, rs.name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, addr := range addrs {
+			targets[net.JoinHostPort(addr, strconv.Itoa(rs.port))] = rs.name
+		}
+	default:
+		addresses := viper.GetStringSlice(rs.section + ".addresses")
+		if len(addresses) == 0 {
+			host := viper.GetString(rs.section + ".host")
+			addresses = []string{net.JoinHostPort(host, strconv.Itoa(rs.port))}
+		}
+
+		for _, address := range addresses {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return nil, err
+			}
+
+			targets[address] = host
+		}
+	}
+
+	return targets, nil
+}
+
+// update connects to new replicas and closes replicas which are gone
+func (rs *ReplicaSet) update(targets map[string]string) error {
+
+	rs.mutex.RLock()
+	current := make(map[string]*Replica, len(rs.replicas))
+	for _, replica := range rs.replicas {
+		current[replica.address] = replica
+	}
+	rs.mutex.RUnlock()
+
+	replicas := make([]*Replica, 0, len(targets))
+	created := make([]*Replica, 0)
+	for address, host := range targets {
+
+		if replica, ok := current[address]; ok {
+			replicas = append(replicas, replica)
+			delete(current, address)
+			continue
+		}
+
+		replica, err := rs.connect(address, host)
+		if err != nil {
+			for _, replica := range created {
+				replica.pool.Close(context.Background())
+			}
+
+			return err
+		}
+
+		replicas = append(replicas, replica)
+		created = append(created, replica)
+	}
+
+	sort.Slice(replicas, func(i, j int) bool {
+		return replicas[i].address < replicas[j].address
+	})
+
+	rs.mutex.Lock()
+
+	// Replica set might be closed during connecting
+	select {
+	case <-rs.done:
+		rs.mutex.Unlock()
+		for _, replica := range created {
+			replica.pool.Close(context.Background())
+		}
+
+		return ErrNoReplica
+	default:
+	}
+
+	rs.replicas = replicas
+	rs.mutex.Unlock()
+
+	// Calls in progress are finished before connections of removed replicas are closed
+	for address, replica := range current {
+
+		log.WithFields(log.Fields{
+			"address": address,
+		}).Info("Removing replica of querykit")
+
+		go replica.pool.Close(context.Background())
+	}
+
+	return nil
+}
+
+func (rs *ReplicaSet) connect(address string, host string) (*Replica, error) {
+
+	log.WithFields(log.Fields{
+		"address": address,
+	}).Info("Adding replica of querykit")
+
+	dialOpts, err := dialOptions(rs.section, host)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := pool.NewGRPCPool(address, rs.options, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Replica{
+		address: address,
+		pool:    p,
+	}, nil
+}
+
+// watch resolves replicas periodically, previous replicas are kept if resolution fails
+func (rs *ReplicaSet) watch() {
+
+	ticker := time.NewTicker(rs.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rs.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), rs.refresh)
+		targets, err := rs.resolve(ctx)
+		cancel()
+
+		if err == nil && len(targets) == 0 {
+			err = ErrNoReplica
+		}
+
+		if err == nil {
+			err = rs.update(targets)
+		}
+
+		if err != nil {
+			log.WithFields(log.Fields{
+				"name": rs.name,
+			}).Error(err)
+		}
+	}
+}
+
+// Pick selects a replica by balancer, ejected replicas are used only if all replicas are ejected
+func (rs *ReplicaSet) Pick() (*Replica, error) {
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	if len(rs.replicas) == 0 {
+		return nil, ErrNoReplica
+	}
+
+	now := time.Now()
+	candidates := make([]*Replica, 0, len(rs.replicas))
+	for _, replica := range rs.replicas {
+		if replica.healthy(now) {
+			candidates = append(candidates, replica)
+		}
+	}
+
+	if len(candidates) == 0 {
+		candidates = rs.replicas
+	}
+
+	start := int(atomic.AddUint64(&rs.next, 1) % uint64(len(candidates)))
+	if rs.balancer == BALANCER_ROUND_ROBIN {
+		return candidates[start], nil
+	}
+
+	// Least outstanding requests, ties are broken in round robin
+	var selected *Replica
+	min := int64(math.MaxInt64)
+	for i := range candidates {
+		replica := candidates[(start+i)%len(candidates)]
+		outstanding := atomic.LoadInt64(&replica.outstanding)
+		if outstanding < min {
+			selected = replica
+			min = outstanding
+		}
+	}
+
+	return selected, nil
+}
+
+// Call runs fn with a connection of selected replica and records its result
+func (rs *ReplicaSet) Call(ctx context.Context, fn func(*grpc.ClientConn) error) error {
+
+	replica, err := rs.Pick()
+	if err != nil {
+		return err
+	}
+
+	replica.begin()
+
+	conn, err := replica.pool.Get(ctx)
+	if err != nil {
+		replica.done(err, rs.threshold, rs.ejectTime)
+		return err
+	}
+
+	err = fn(conn)
+	replica.pool.Put(conn)
+	replica.done(err, rs.threshold, rs.ejectTime)
+
+	return err
+}
+
+func (rs *ReplicaSet) Stats() []*ReplicaStats {
+
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	stats := make([]*ReplicaStats, 0, len(rs.replicas))
+	for _, replica := range rs.replicas {
+		stats = append(stats, replica.Stats())
+	}
+
+	return stats
+}
+
+// Close stops discovery and closes connections of all replicas
+func (rs *ReplicaSet) Close(ctx context.Context) error {
+
+	rs.mutex.Lock()
+
+	select {
+	case <-rs.done:
+	default:
+		close(rs.done)
+	}
+
+	replicas := rs.replicas
+	rs.replicas = nil
+
+	rs.mutex.Unlock()
+
+	var result error
+	for _, replica := range replicas {
+		err := replica.pool.Close(ctx)
+		if err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
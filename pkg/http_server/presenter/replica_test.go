@@ -0,0 +1,274 @@
+package presenter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-presenter-rest/pkg/http_server/presenter/pool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestReplicaSet(t *testing.T, maxCap int, addresses ...string) *ReplicaSet {
+
+	rs := NewReplicaSet("replica_test", &pool.Options{
+		MaxCap:      maxCap,
+		DialTimeout: time.Second,
+		IdleTimeout: time.Minute,
+	})
+
+	rs.balancer = BALANCER_ROUND_ROBIN
+	rs.threshold = 2
+	rs.ejectTime = time.Hour
+
+	if err := rs.update(replicaTargets(addresses...)); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		rs.Close(ctx)
+	})
+
+	return rs
+}
+
+func replicaTargets(addresses ...string) map[string]string {
+
+	targets := make(map[string]string, len(addresses))
+	for _, address := range addresses {
+		targets[address] = "127.0.0.1"
+	}
+
+	return targets
+}
+
+func TestReplicaEjection(t *testing.T) {
+
+	rs := newTestReplicaSet(t, 1, "127.0.0.1:1")
+	replica := rs.replicas[0]
+
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	// Errors of callers are not failures of replica
+	errs := []error{
+		context.DeadlineExceeded,
+		context.Canceled,
+		callerError(expired, status.Error(codes.DeadlineExceeded, "context deadline exceeded")),
+		status.Error(codes.InvalidArgument, "invalid"),
+	}
+
+	for _, err := range errs {
+		replica.begin()
+		replica.done(err, rs.threshold, rs.ejectTime)
+	}
+
+	stats := replica.Stats()
+	if stats.Failures != 0 || !stats.Healthy {
+		t.Fatalf("stats = %+v, want healthy without failures", stats)
+	}
+
+	// Success resets consecutive failures
+	for _, err := range []error{errUnavailable, nil, errUnavailable} {
+		replica.begin()
+		replica.done(err, rs.threshold, rs.ejectTime)
+	}
+
+	if !replica.healthy(time.Now()) {
+		t.Fatal("replica is ejected without consecutive failures")
+	}
+
+	replica.begin()
+	replica.done(status.Error(codes.DeadlineExceeded, "timeout"), rs.threshold, rs.ejectTime)
+
+	stats = replica.Stats()
+	if stats.Healthy || stats.Ejections != 1 || stats.Failures != 3 || stats.Outstanding != 0 {
+		t.Errorf("stats = %+v, want ejected replica", stats)
+	}
+
+	if !replica.healthy(time.Now().Add(rs.ejectTime)) {
+		t.Error("replica is not healthy after eject time")
+	}
+}
+
+func TestReplicaSetPick(t *testing.T) {
+
+	rs := newTestReplicaSet(t, 1, "127.0.0.1:1", "127.0.0.1:2")
+
+	eject := func(replica *Replica) {
+		replica.mutex.Lock()
+		replica.ejectedUntil = time.Now().Add(time.Hour)
+		replica.mutex.Unlock()
+	}
+
+	// Ejected replica is skipped
+	eject(rs.replicas[0])
+
+	for i := 0; i < 4; i++ {
+		replica, err := rs.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if replica != rs.replicas[1] {
+			t.Fatalf("ejected replica %s is picked", replica.address)
+		}
+	}
+
+	// All of replicas are used if all of them are ejected
+	eject(rs.replicas[1])
+
+	picked := make(map[string]bool)
+	for i := 0; i < 4; i++ {
+		replica, err := rs.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		picked[replica.address] = true
+	}
+
+	if len(picked) != 2 {
+		t.Errorf("picked = %v, want both replicas", picked)
+	}
+}
+
+func TestReplicaSetLeastOutstanding(t *testing.T) {
+
+	rs := newTestReplicaSet(t, 1, "127.0.0.1:1", "127.0.0.1:2")
+	rs.balancer = BALANCER_LEAST_OUTSTANDING
+
+	rs.replicas[0].begin()
+	defer rs.replicas[0].done(nil, rs.threshold, rs.ejectTime)
+
+	for i := 0; i < 4; i++ {
+		replica, err := rs.Pick()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if replica != rs.replicas[1] {
+			t.Fatalf("busy replica %s is picked", replica.address)
+		}
+	}
+}
+
+func TestReplicaSetUpdate(t *testing.T) {
+
+	rs := newTestReplicaSet(t, 1, "127.0.0.1:1", "127.0.0.1:2")
+
+	removed := rs.replicas[0]
+	kept := rs.replicas[1]
+
+	// Result of refreshing DNS
+	if err := rs.update(replicaTargets("127.0.0.1:2", "127.0.0.1:3")); err != nil {
+		t.Fatal(err)
+	}
+
+	addresses := make([]string, 0)
+	for _, replica := range rs.replicas {
+		addresses = append(addresses, replica.address)
+	}
+
+	if fmt.Sprint(addresses) != "[127.0.0.1:2 127.0.0.1:3]" {
+		t.Fatalf("replicas = %v", addresses)
+	}
+
+	if rs.replicas[0] != kept {
+		t.Error("existing replica is reconnected")
+	}
+
+	// Connections of removed replica are closed
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err := removed.pool.Get(context.Background())
+		if err == pool.ErrClosed {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("pool of removed replica is not closed, error = %v", err)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicaSetResolveA(t *testing.T) {
+
+	rs := NewReplicaSet("replica_test", pool.NewOptions())
+	rs.discovery = "a"
+	rs.name = "localhost"
+	rs.port = 44149
+
+	targets, err := rs.resolve(context.Background())
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// Host name is kept for verification of TLS
+	if host, ok := targets["127.0.0.1:44149"]; !ok || host != "localhost" {
+		t.Errorf("targets = %v", targets)
+	}
+}
+
+func TestReplicaSetCall(t *testing.T) {
+
+	rs := newTestReplicaSet(t, 1, "127.0.0.1:1")
+	replica := rs.replicas[0]
+
+	// Only the connection is in use by a slow call
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go rs.Call(context.Background(), func(conn *grpc.ClientConn) error {
+		close(started)
+		<-release
+		return nil
+	})
+
+	<-started
+
+	// Waiting for connection until deadline is not a failure of replica
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err := rs.Call(ctx, func(conn *grpc.ClientConn) error {
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+
+	// Deadline of caller which is reported by gRPC client is not a failure either
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	for i := 0; i < rs.threshold; i++ {
+		rs.Call(expired, func(conn *grpc.ClientConn) error {
+			return status.Error(codes.DeadlineExceeded, "context deadline exceeded")
+		})
+	}
+
+	if stats := replica.Stats(); stats.Failures != 0 || !stats.Healthy {
+		t.Fatalf("stats = %+v, want healthy without failures", stats)
+	}
+
+	// Failures of server eject replica
+	for i := 0; i < rs.threshold; i++ {
+		rs.Call(context.Background(), func(conn *grpc.ClientConn) error {
+			return errUnavailable
+		})
+	}
+
+	if stats := replica.Stats(); stats.Failures != 2 || stats.Healthy {
+		t.Errorf("stats = %+v, want ejected replica", stats)
+	}
+}
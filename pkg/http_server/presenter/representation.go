@@ -0,0 +1,259 @@
+package presenter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// TemplateEngine is implemented by both text/template and html/template
+type TemplateEngine interface {
+	Execute(io.Writer, interface{}) error
+}
+
+var defaultContentTypes = map[string]string{
+	"":         "application/json",
+	"template": "application/json",
+	"json":     "application/json",
+	"ndjson":   "application/x-ndjson",
+	"csv":      "text/csv",
+}
+
+// RenderError is returned if template failed to be executed
+type RenderError struct {
+	Template string
+	Err      error
+}
+
+func (e *RenderError) Error() string {
+	return e.Err.Error()
+}
+
+// Representation describes how to render data for a media type
+type Representation struct {
+	ContentType string            `json:"contentType"`
+	Template    string            `json:"template"`
+	Render      string            `json:"render"`
+	JSON        *JSONRenderConfig `json:"json"`
+	CSV         *CSVRenderConfig  `json:"csv"`
+	Engine      string            `json:"engine"`
+	Filename    string            `json:"filename"`
+	template    TemplateEngine
+	filename    string
+	mediaType   string
+}
+
+func (rep *Representation) Load(dirPath string, defaultName string, funcs map[string]interface{}) error {
+
+	if len(rep.ContentType) == 0 {
+		rep.ContentType = defaultContentTypes[rep.Render]
+	}
+
+	mediaType, _, err := mime.ParseMediaType(rep.ContentType)
+	if err != nil {
+		return err
+	}
+
+	rep.mediaType = mediaType
+
+	switch rep.Render {
+	case "", "template":
+	case "json":
+		if rep.JSON == nil {
+			rep.JSON = &JSONRenderConfig{}
+		}
+
+		return rep.JSON.Init()
+	case "ndjson":
+		if rep.JSON == nil {
+			rep.JSON = &JSONRenderConfig{}
+		}
+
+		return rep.JSON.Init()
+	case "csv":
+		if rep.CSV == nil {
+			rep.CSV = &CSVRenderConfig{}
+		}
+
+		return rep.CSV.Init()
+	default:
+		return fmt.Errorf("Unknown render \"%s\"", rep.Render)
+	}
+
+	// Template is resolved without changing settings because representations can be shared by states
+	filename := rep.Template
+	if len(filename) == 0 {
+		filename = filepath.Join(dirPath, defaultName+".tmpl")
+	} else if !filepath.IsAbs(filename) {
+		filename = filepath.Join(dirPath, filename)
+	}
+
+	rep.filename = filename
+	tpName := filepath.Base(filename)
+
+	// Load template
+	switch rep.getEngine() {
+	case "html":
+		t, err := htmltemplate.New(tpName).Funcs(funcs).ParseFiles(filename)
+		if err != nil {
+			return err
+		}
+
+		rep.template = t
+	case "text":
+		t, err := template.New(tpName).Funcs(funcs).ParseFiles(filename)
+		if err != nil {
+			return err
+		}
+
+		rep.template = t
+	default:
+		return fmt.Errorf("Unknown template engine \"%s\"", rep.Engine)
+	}
+
+	return nil
+}
+
+// getEngine returns template engine, html/template is used for HTML to escape content automatically
+func (rep *Representation) getEngine() string {
+
+	if len(rep.Engine) > 0 {
+		return rep.Engine
+	}
+
+	switch rep.mediaType {
+	case "text/html", "application/xhtml+xml":
+		return "html"
+	}
+
+	return "text"
+}
+
+// render writes response, nothing will be written if it failed to render with template
+func (rep *Representation) render(c *gin.Context, code int, data *ViewData) error {
+
+	if len(rep.Filename) > 0 {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": rep.Filename,
+		}))
+	}
+
+	if rep.Render == "csv" || rep.Render == "ndjson" {
+		c.Writer.Header().Set("Content-Type", rep.ContentType)
+		c.Status(code)
+
+		// Headers were sent already, error can only be logged
+		err := rep.stream(c.Writer, data)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"render": rep.Render,
+			}).Error(err)
+		}
+
+		return nil
+	}
+
+	data.loadRecords()
+
+	var body []byte
+	if rep.Render == "json" {
+		b, err := rep.JSON.Render(data)
+		if err != nil {
+			return &RenderError{
+				Template: rep.Render,
+				Err:      err,
+			}
+		}
+
+		body = b
+	} else {
+		var buf bytes.Buffer
+		err := rep.template.Execute(&buf, data)
+		if err != nil {
+			return &RenderError{
+				Template: rep.filename,
+				Err:      err,
+			}
+		}
+
+		body = buf.Bytes()
+	}
+
+	// Client has the same content already
+	if code >= 200 && code < 300 {
+		etag := generateETag(body)
+		c.Header("ETag", etag)
+
+		if isNotModified(c.Request, etag) {
+			c.Status(http.StatusNotModified)
+			c.Writer.WriteHeaderNow()
+			return nil
+		}
+	}
+
+	c.Header("Content-Length", strconv.Itoa(len(body)))
+	c.Data(code, rep.ContentType, body)
+
+	return nil
+}
+
+// stream writes records to response while they are being decoded
+func (rep *Representation) stream(w io.Writer, data *ViewData) error {
+
+	buf := bufio.NewWriter(w)
+
+	var err error
+	switch rep.Render {
+	case "csv":
+		err = rep.CSV.Render(buf, data)
+	case "ndjson":
+		err = rep.JSON.RenderLines(buf, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return buf.Flush()
+}
+
+func generateETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
+
+// isNotModified checks If-None-Match header of GET and HEAD requests
+func isNotModified(req *http.Request, etag string) bool {
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	header := req.Header.Get("If-None-Match")
+	if len(header) == 0 {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,168 @@
+package presenter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const scriptFixture = `[{ "id": 1, "name": "<script>alert(\"x\")</script>" }]`
+
+func TestRepresentationEngine(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		contentType string
+		engine      string
+		body        string
+	}{
+		{"html", "text/html; charset=utf-8", "", `<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`},
+		{"xhtml", "application/xhtml+xml", "", `<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`},
+		{"json", "application/json", "", `<p><script>alert("x")</script></p>`},
+		{"html with text engine", "text/html", "text", `<p><script>alert("x")</script></p>`},
+		{"json with html engine", "application/json", "html", `<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`},
+	}
+
+	settings := map[string]string{
+		"page.tmpl": `{{ range .Records }}<p>{{ .name }}</p>{{ end }}`,
+	}
+
+	for i, test := range tests {
+		settings[fmt.Sprintf("endpoint%d.json", i)] = fmt.Sprintf(`{
+			"method": "get",
+			"uri": "/%d",
+			"query": { "table": "accounts" },
+			"response": {
+				"state": {
+					"success": { "contentType": %q, "engine": %q, "template": "page.tmpl" }
+				}
+			}
+		}`, i, test.contentType, test.engine)
+	}
+
+	presenter := newTestPresenter(t, settings, map[string]string{
+		"accounts.json": scriptFixture,
+	})
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			w := serveTest(presenter, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/%d", i), nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("code = %d, body = %s", w.Code, w.Body.String())
+			}
+
+			if body := w.Body.String(); body != test.body {
+				t.Errorf("body = %s, want %s", body, test.body)
+			}
+
+			if contentType := w.Header().Get("Content-Type"); contentType != test.contentType {
+				t.Errorf("Content-Type = %s, want %s", contentType, test.contentType)
+			}
+		})
+	}
+}
+
+func TestRepresentationUnknownEngine(t *testing.T) {
+
+	dir := writeTestFiles(t, map[string]string{
+		"page.tmpl": `{{ .Records }}`,
+	})
+
+	rep := &Representation{
+		ContentType: "text/html",
+		Template:    "page.tmpl",
+		Engine:      "jinja",
+	}
+
+	err := rep.Load(dir, "success", templateFuncs())
+	if err == nil || !strings.Contains(err.Error(), `Unknown template engine "jinja"`) {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestRenderTemplateFailure(t *testing.T) {
+
+	endpoint := func(uri string, errorState string) string {
+		return fmt.Sprintf(`{
+			"method": "get",
+			"uri": %q,
+			"query": { "table": "accounts" },
+			"response": {
+				"state": {
+					"success": {
+						"template": "first.tmpl",
+						"headers": { "X-Partial": "true" }
+					}%s
+				}
+			}
+		}`, uri, errorState)
+	}
+
+	presenter := newTestPresenter(t, map[string]string{
+		"builtin.json":  endpoint("/builtin", ""),
+		"template.json": endpoint("/template", `, "error": { "template": "error.tmpl" }`),
+		"broken.json":   endpoint("/broken", `, "error": { "template": "broken.tmpl" }`),
+		"first.tmpl":    `partial {{ (index .Records 0).name }}`,
+		"error.tmpl":    `{"failed":"{{ .Error.Kind }}","requestId":"{{ .RequestID }}"}`,
+		"broken.tmpl":   `partial error {{ index .Errors 0 }}`,
+	}, map[string]string{
+		"accounts.json": `[]`,
+	})
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{"built-in error", "/builtin", `{"error":{"kind":"template","requestId":"req-1"}}`},
+		{"error template", "/template", `{"failed":"template","requestId":"req-1"}`},
+		{"broken error template", "/broken", `{"error":{"kind":"template","requestId":"req-1"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+
+			w := serveTest(presenter, req)
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("code = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+
+			// Nothing of the failed template is sent
+			body := w.Body.String()
+			if strings.Contains(body, "partial") {
+				t.Fatalf("body = %s, partial response is sent", body)
+			}
+
+			for _, name := range []string{"X-Partial", "ETag"} {
+				if value := w.Header().Get(name); len(value) > 0 {
+					t.Errorf("header %s = %s of failed state", name, value)
+				}
+			}
+
+			// Message of built-in error is written by template package, so it is not compared
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body = %s, %v", body, err)
+			}
+
+			if e, ok := got["error"].(map[string]interface{}); ok {
+				delete(e, "message")
+			}
+
+			var want map[string]interface{}
+			json.Unmarshal([]byte(test.body), &want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %s, want %s", body, test.body)
+			}
+		})
+	}
+}
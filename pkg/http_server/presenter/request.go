@@ -0,0 +1,230 @@
+package presenter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/gin-gonic/gin"
+)
+
+const maxMultipartMemory = 32 << 20
+
+const RequestIDHeader = "X-Request-ID"
+
+// RequestContext contains everything of a HTTP request which scripts can access.
+// It is prepared once for each request and shared by all scripts of the endpoint.
+type RequestContext struct {
+	RequestID string
+	Method    string
+	Path      string
+	ClientIP  string
+	Query     map[string]interface{}
+	Params    map[string]interface{}
+	Headers   map[string]interface{}
+	Cookies   map[string]string
+	Body      interface{}
+
+	queryValues url.Values
+}
+
+func NewRequestContext(ctx *gin.Context) (*RequestContext, error) {
+
+	query := ctx.Request.URL.Query()
+
+	rc := &RequestContext{
+		RequestID:   getRequestID(ctx),
+		Method:      ctx.Request.Method,
+		Path:        ctx.Request.URL.Path,
+		ClientIP:    ctx.ClientIP(),
+		Query:       make(map[string]interface{}, len(query)),
+		Params:      make(map[string]interface{}, len(ctx.Params)),
+		Headers:     make(map[string]interface{}, len(ctx.Request.Header)),
+		Cookies:     make(map[string]string),
+		queryValues: query,
+	}
+
+	// Query string, the first value is used unless parameter is declared as array
+	for k, v := range query {
+		rc.Query[k] = v[0]
+	}
+
+	// Path parameters
+	for _, p := range ctx.Params {
+		rc.Params[p.Key] = p.Value
+	}
+
+	// Header names are case-insensitive, so lower case is used for scripts
+	for k, v := range ctx.Request.Header {
+		rc.Headers[strings.ToLower(k)] = v[0]
+	}
+
+	for _, cookie := range ctx.Request.Cookies() {
+		rc.Cookies[cookie.Name] = cookie.Value
+	}
+
+	// Body
+	body, err := parseBody(ctx)
+	if err != nil {
+		return rc, err
+	}
+
+	rc.Body = body
+
+	return rc, nil
+}
+
+// Apply sets request information to be global variables of script runtime
+func (rc *RequestContext) Apply(runtime *goja.Runtime) {
+	runtime.Set("requestID", rc.RequestID)
+	runtime.Set("method", rc.Method)
+	runtime.Set("path", rc.Path)
+	runtime.Set("clientIP", rc.ClientIP)
+	runtime.Set("query", rc.Query)
+	runtime.Set("param", rc.Params)
+	runtime.Set("headers", rc.Headers)
+	runtime.Set("cookies", rc.Cookies)
+	runtime.Set("body", rc.Body)
+}
+
+// getRequestID uses request ID from client or generates a new one
+func getRequestID(ctx *gin.Context) string {
+
+	id := ctx.GetHeader(RequestIDHeader)
+	if len(id) > 0 {
+		return id
+	}
+
+	buf := make([]byte, 16)
+	rand.Read(buf)
+
+	return hex.EncodeToString(buf)
+}
+
+func parseBody(ctx *gin.Context) (interface{}, error) {
+
+	if ctx.Request.Body == nil || ctx.Request.ContentLength == 0 {
+		return nil, nil
+	}
+
+	switch ctx.ContentType() {
+	case gin.MIMEJSON:
+		var body interface{}
+		err := json.NewDecoder(ctx.Request.Body).Decode(&body)
+		if err == io.EOF {
+			return nil, nil
+		}
+
+		return body, err
+	case gin.MIMEXML, gin.MIMEXML2:
+		return parseXML(ctx.Request.Body)
+	case gin.MIMEPOSTForm:
+		err := ctx.Request.ParseForm()
+		if err != nil {
+			return nil, err
+		}
+
+		return formToMap(ctx.Request.PostForm), nil
+	case gin.MIMEMultipartPOSTForm:
+		err := ctx.Request.ParseMultipartForm(maxMultipartMemory)
+		if err != nil {
+			return nil, err
+		}
+
+		return formToMap(ctx.Request.MultipartForm.Value), nil
+	}
+
+	return nil, nil
+}
+
+func formToMap(form map[string][]string) map[string]interface{} {
+
+	body := make(map[string]interface{}, len(form))
+	for k, v := range form {
+
+		if len(v) == 1 {
+			body[k] = v[0]
+			continue
+		}
+
+		values := make([]interface{}, 0, len(v))
+		for _, value := range v {
+			values = append(values, value)
+		}
+
+		body[k] = values
+	}
+
+	return body
+}
+
+// parseXML converts XML document to a map which has the same structure with JSON,
+// the root element is omitted and attributes are named with "@" prefix.
+func parseXML(r io.Reader) (interface{}, error) {
+
+	decoder := xml.NewDecoder(r)
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return parseXMLElement(decoder, start)
+		}
+	}
+}
+
+func parseXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+
+	element := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		element["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := parseXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+
+			// Elements with the same name become an array
+			name := t.Name.Local
+			if existing, ok := element[name]; ok {
+				if arr, ok := existing.([]interface{}); ok {
+					element[name] = append(arr, child)
+				} else {
+					element[name] = []interface{}{existing, child}
+				}
+			} else {
+				element[name] = child
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if len(element) == 0 {
+				return strings.TrimSpace(text.String()), nil
+			}
+
+			return element, nil
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package presenter
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRequestContext(t *testing.T, req *http.Request) (*RequestContext, error) {
+
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = req
+
+	return NewRequestContext(c)
+}
+
+func multipartBody(t *testing.T, fields [][2]string) (string, string) {
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	part, err := writer.CreateFormFile("file", "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part.Write([]byte("content of file"))
+	writer.Close()
+
+	return writer.FormDataContentType(), buf.String()
+}
+
+func TestParseBody(t *testing.T) {
+
+	multipartType, multipartContent := multipartBody(t, [][2]string{{"name", "alice"}, {"tag", "a"}, {"tag", "b"}})
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        interface{}
+		err         bool
+	}{
+		{
+			"json",
+			"application/json; charset=utf-8",
+			`{ "name": "alice", "age": 20, "tags": [ "a" ], "profile": { "vip": true }, "note": null }`,
+			map[string]interface{}{
+				"name":    "alice",
+				"age":     20.0,
+				"tags":    []interface{}{"a"},
+				"profile": map[string]interface{}{"vip": true},
+				"note":    nil,
+			},
+			false,
+		},
+		{"json array", "application/json", `[1, "a"]`, []interface{}{1.0, "a"}, false},
+		{"json blank", "application/json", "  \n", nil, false},
+		{"json malformed", "application/json", `{ "name": `, nil, true},
+		{"json invalid", "application/json", `{ name: 'alice' }`, nil, true},
+		{
+			"xml",
+			"application/xml",
+			`<?xml version="1.0"?>
+			<account id="1" type="user">
+				<name>alice</name>
+				<tag>a</tag>
+				<tag>b</tag>
+				<tag>c</tag>
+				<profile vip="true"><city> Taipei </city></profile>
+				<empty/>
+			</account>`,
+			map[string]interface{}{
+				"@id":   "1",
+				"@type": "user",
+				"name":  "alice",
+				"tag":   []interface{}{"a", "b", "c"},
+				"profile": map[string]interface{}{
+					"@vip": "true",
+					"city": "Taipei",
+				},
+				"empty": "",
+			},
+			false,
+		},
+		{"xml text root", "text/xml", `<id>1</id>`, "1", false},
+		{"xml without element", "application/xml", `<?xml version="1.0"?>`, nil, false},
+		{"xml malformed", "application/xml", `<account><name>alice</account>`, nil, true},
+		{"xml unclosed", "application/xml", `<account><name>alice</name>`, nil, true},
+		{
+			"form",
+			"application/x-www-form-urlencoded",
+			"name=alice&tag=a&tag=b&empty=",
+			map[string]interface{}{
+				"name":  "alice",
+				"tag":   []interface{}{"a", "b"},
+				"empty": "",
+			},
+			false,
+		},
+		{"form malformed", "application/x-www-form-urlencoded", "name=%zz", nil, true},
+		{
+			"multipart",
+			multipartType,
+			multipartContent,
+			map[string]interface{}{
+				"name": "alice",
+				"tag":  []interface{}{"a", "b"},
+			},
+			false,
+		},
+		{"multipart without boundary", "multipart/form-data", multipartContent, nil, true},
+		{"multipart malformed", multipartType, "--broken", nil, true},
+		{"unknown content type", "text/plain", "name=alice", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(http.MethodPost, "/accounts", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+
+			rc, err := newTestRequestContext(t, req)
+			if test.err {
+				if err == nil {
+					t.Fatalf("body = %#v, want error", rc.Body)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(rc.Body, test.want) {
+				t.Errorf("body = %#v, want %#v", rc.Body, test.want)
+			}
+		})
+	}
+}
+
+func TestRequestContextGlobals(t *testing.T) {
+
+	req := httptest.NewRequest(http.MethodGet, "/accounts/1?type=a&type=b", nil)
+	req.Header.Set("X-Token", "secret")
+	req.Header.Add("X-Token", "other")
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	req.AddCookie(&http.Cookie{Name: "theme", Value: "dark"})
+
+	rc, err := newTestRequestContext(t, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runtime := newRuntime()
+	rc.Apply(runtime)
+
+	tests := []struct {
+		script string
+		want   interface{}
+	}{
+		{"headers['x-token']", "secret"},
+		{"headers['X-Token']", nil},
+		{"headers['x-request-id']", "req-1"},
+		{"cookies.session + ',' + cookies.theme", "abc,dark"},
+		{"cookies.missing", nil},
+		{"query.type", "a"},
+		{"requestID", "req-1"},
+		{"method + ' ' + path", "GET /accounts/1"},
+		{"body", nil},
+	}
+
+	for _, test := range tests {
+
+		value, err := runtime.RunString(test.script)
+		if err != nil {
+			t.Fatalf("%s: %v", test.script, err)
+		}
+
+		if got := value.Export(); got != test.want {
+			t.Errorf("%s = %#v, want %#v", test.script, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package presenter
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides delay between attempts with jittered exponential backoff
+type RetryPolicy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns delay before next attempt, it is between half and full of exponential backoff
+func (policy *RetryPolicy) Backoff(attempt int) time.Duration {
+
+	backoff := policy.InitialBackoff
+	for i := 0; i < attempt && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	half := backoff / 2
+
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,112 @@
+package presenter
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type RouteTable struct {
+	engine    *gin.Engine
+	endpoints map[string]*Endpoint
+	states    map[string]*StateDefinition
+}
+
+func NewRouteTable(endpoints map[string]*Endpoint, states map[string]*StateDefinition) (*RouteTable, error) {
+
+	table := &RouteTable{
+		engine:    gin.New(),
+		endpoints: endpoints,
+		states:    states,
+	}
+
+	table.engine.Use(gin.Recovery())
+	table.engine.NoRoute(table.notFound)
+
+	for _, endpoint := range endpoints {
+		if err := table.register(endpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	return table, nil
+}
+
+func (table *RouteTable) register(endpoint *Endpoint) (err error) {
+
+	// gin panics if routes are conflicting
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Failed to register endpoint \"%s\": %v", endpoint.name, r)
+		}
+	}()
+
+	return endpoint.Register(table.engine)
+}
+
+func (table *RouteTable) notFound(c *gin.Context) {
+
+	requestID := getRequestID(c)
+	c.Header(RequestIDHeader, requestID)
+
+	data := &ViewData{
+		Error: &ErrorData{
+			Kind:    "route",
+			Message: "Route not found",
+		},
+		RequestID: requestID,
+	}
+
+	if state, ok := table.states["not_found_route"]; ok {
+		err := renderState(c, state, data)
+		if err == nil {
+			return
+		}
+
+		log.WithFields(log.Fields{
+			"state":     "not_found_route",
+			"template":  renderedTemplate(err),
+			"requestID": requestID,
+		}).Error(err)
+
+		clearHeaders(c, state)
+	}
+
+	renderBuiltinError(c, "not_found_route", data)
+}
+
+type Router struct {
+	table atomic.Value
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+func (router *Router) Swap(table *RouteTable) {
+	router.table.Store(table)
+}
+
+func (router *Router) GetTable() *RouteTable {
+
+	table, ok := router.table.Load().(*RouteTable)
+	if !ok {
+		return nil
+	}
+
+	return table
+}
+
+func (router *Router) Handle(c *gin.Context) {
+
+	// Requests keep running on the table which was loaded when they arrived
+	table := router.GetTable()
+	if table == nil {
+		return
+	}
+
+	table.engine.ServeHTTP(c.Writer, c.Request)
+	c.Writer.WriteHeaderNow()
+}
@@ -0,0 +1,158 @@
+package presenter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const headEndpoint = `{
+	"method": "get",
+	"uri": "/accounts",
+	"query": {
+		"table": "accounts"
+	},
+	"response": {
+		"state": {
+			"success": {
+				"render": "json"
+			}
+		}
+	}
+}`
+
+// writeTestFiles writes files into a temporary directory which is removed after test
+func writeTestFiles(t *testing.T, files map[string]string) string {
+
+	dir, err := ioutil.TempDir("", "presenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+// newTestPresenter loads settings from files, and tables of fixtures are served by fixture backend
+func newTestPresenter(t *testing.T, settings map[string]string, fixtures map[string]string) *Presenter {
+	return loadTestPresenter(t, settings, newTestFixtureBackend(t, fixtures))
+}
+
+// loadTestPresenter loads settings from files with backend as the default data source
+func loadTestPresenter(t *testing.T, settings map[string]string, backend Backend) *Presenter {
+
+	presenter := &Presenter{
+		router:       NewRouter(),
+		dataSources:  NewDataSources(),
+		settingsPath: writeTestFiles(t, settings),
+	}
+
+	presenter.dataSources.backends[DefaultDataSource] = backend
+
+	gin.SetMode(gin.TestMode)
+
+	if err := presenter.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	return presenter
+}
+
+// serveTest handles request with the current route table
+func serveTest(presenter *Presenter, req *http.Request) *httptest.ResponseRecorder {
+
+	w := httptest.NewRecorder()
+	presenter.router.GetTable().engine.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRouteTableHead(t *testing.T) {
+
+	presenter := newTestPresenter(t, map[string]string{
+		"endpoint.json": headEndpoint,
+	}, map[string]string{
+		"accounts.json": `[{ "id": 1, "name": "alice" }]`,
+	})
+
+	server := httptest.NewServer(presenter.router.GetTable().engine)
+	defer server.Close()
+
+	get, err := http.Get(server.URL + "/accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(get.Body)
+	get.Body.Close()
+
+	if get.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Fatalf("GET = %d %s", get.StatusCode, body)
+	}
+
+	// HEAD has the same headers without body
+	head, err := http.Head(server.URL + "/accounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ = ioutil.ReadAll(head.Body)
+	head.Body.Close()
+
+	if head.StatusCode != http.StatusOK {
+		t.Errorf("HEAD = %d, want %d", head.StatusCode, http.StatusOK)
+	}
+
+	if len(body) != 0 {
+		t.Errorf("HEAD has body %s", body)
+	}
+
+	for _, name := range []string{"Content-Type", "ETag"} {
+		if head.Header.Get(name) != get.Header.Get(name) {
+			t.Errorf("%s of HEAD = %q, want %q", name, head.Header.Get(name), get.Header.Get(name))
+		}
+	}
+
+	// Conditional HEAD request
+	req, _ := http.NewRequest(http.MethodHead, server.URL+"/accounts", nil)
+	req.Header.Set("If-None-Match", get.Header.Get("ETag"))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("HEAD with If-None-Match = %d, want %d", resp.StatusCode, http.StatusNotModified)
+	}
+
+	resp, err = http.Head(server.URL + "/bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("HEAD of unknown route = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,85 @@
+package presenter
+
+import (
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+func CompileScript(name string, source string) (*goja.Program, error) {
+	return goja.Compile(name, source, false)
+}
+
+// RuntimePool keeps script runtimes for reusing, because creating a new runtime is expensive.
+// Globals which are set by requests and scripts are removed when a runtime is returned to pool.
+type RuntimePool struct {
+	pool    sync.Pool
+	globals map[string]bool
+}
+
+func NewRuntimePool() *RuntimePool {
+
+	rp := &RuntimePool{
+		globals: make(map[string]bool),
+	}
+
+	rp.pool.New = func() interface{} {
+		return newRuntime()
+	}
+
+	// Globals of a new runtime are kept
+	for _, name := range newRuntime().GlobalObject().Keys() {
+		rp.globals[name] = true
+	}
+
+	return rp
+}
+
+func newRuntime() *goja.Runtime {
+
+	runtime := goja.New()
+	runtime.SetFieldNameMapper(goja.UncapFieldNameMapper())
+
+	// Scripts are able to respond with specific state
+	runtime.Set("fail", func(state string, message string) {
+		panic(runtime.NewGoError(&StateError{
+			State:   state,
+			Kind:    "script",
+			Message: message,
+		}))
+	})
+
+	return runtime
+}
+
+func (rp *RuntimePool) Get() *goja.Runtime {
+	return rp.pool.Get().(*goja.Runtime)
+}
+
+func (rp *RuntimePool) Put(runtime *goja.Runtime) {
+	runtime.ClearInterrupt()
+	rp.reset(runtime)
+	rp.pool.Put(runtime)
+}
+
+func (rp *RuntimePool) reset(runtime *goja.Runtime) {
+	resetGlobals(runtime, rp.globals)
+}
+
+// resetGlobals removes globals of previous request, so nothing is leaked to the next request
+func resetGlobals(runtime *goja.Runtime, globals map[string]bool) {
+
+	global := runtime.GlobalObject()
+	for _, name := range global.Keys() {
+
+		if globals[name] {
+			continue
+		}
+
+		// Variables declared by "var" and "function" can not be deleted
+		err := global.Delete(name)
+		if err != nil {
+			global.Set(name, goja.Undefined())
+		}
+	}
+}
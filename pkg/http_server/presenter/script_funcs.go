@@ -0,0 +1,195 @@
+package presenter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode"
+
+	"github.com/dop251/goja"
+	log "github.com/sirupsen/logrus"
+)
+
+// ScriptFunctions provides functions which are written in JavaScript for templates
+type ScriptFunctions struct {
+	programs []*goja.Program
+	names    []string
+	globals  map[string]bool
+	runtimes sync.Pool
+}
+
+func NewScriptFunctions() *ScriptFunctions {
+
+	return &ScriptFunctions{
+		programs: make([]*goja.Program, 0),
+		names:    make([]string, 0),
+		globals:  make(map[string]bool),
+	}
+}
+
+// Load compiles all of ".js" files in settings path
+func (sf *ScriptFunctions) Load(settingsPath string) error {
+
+	err := filepath.Walk(settingsPath, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || filepath.Ext(path) != ".js" {
+			return nil
+		}
+
+		log.WithFields(log.Fields{
+			"filename": info.Name(),
+		}).Info("Loading template functions")
+
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		program, err := CompileScript(info.Name(), string(source))
+		if err != nil {
+			return err
+		}
+
+		sf.programs = append(sf.programs, program)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(sf.programs) == 0 {
+		return nil
+	}
+
+	// Find out functions which are defined by scripts
+	runtime, err := sf.newRuntime()
+	if err != nil {
+		return err
+	}
+
+	builtins := make(map[string]bool)
+	for _, name := range goja.New().GlobalObject().Keys() {
+		builtins[name] = true
+	}
+
+	for _, name := range runtime.GlobalObject().Keys() {
+
+		// Globals defined by scripts are kept when runtime is returned to pool
+		sf.globals[name] = true
+
+		if builtins[name] {
+			continue
+		}
+
+		if _, ok := goja.AssertFunction(runtime.Get(name)); !ok {
+			continue
+		}
+
+		// Templates panic with function which is not named as an identifier
+		if !isFuncName(name) {
+			return fmt.Errorf("Invalid name of template function \"%s\"", name)
+		}
+
+		sf.names = append(sf.names, name)
+	}
+
+	sf.runtimes.Put(runtime)
+
+	return nil
+}
+
+// isFuncName returns true if name is a valid identifier for templates
+func isFuncName(name string) bool {
+
+	if name == "" {
+		return false
+	}
+
+	for i, r := range name {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func (sf *ScriptFunctions) newRuntime() (*goja.Runtime, error) {
+
+	runtime := goja.New()
+	runtime.SetFieldNameMapper(goja.UncapFieldNameMapper())
+
+	for _, program := range sf.programs {
+		_, err := runtime.RunProgram(program)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return runtime, nil
+}
+
+// Funcs returns functions for templates
+func (sf *ScriptFunctions) Funcs() map[string]interface{} {
+
+	funcs := make(map[string]interface{}, len(sf.names))
+	for _, name := range sf.names {
+		name := name
+		funcs[name] = func(args ...interface{}) (interface{}, error) {
+			return sf.call(name, args...)
+		}
+	}
+
+	return funcs
+}
+
+// getRuntime takes runtime from pool, or creates a new one if pool is empty
+func (sf *ScriptFunctions) getRuntime() (*goja.Runtime, error) {
+
+	if runtime, ok := sf.runtimes.Get().(*goja.Runtime); ok {
+		return runtime, nil
+	}
+
+	return sf.newRuntime()
+}
+
+func (sf *ScriptFunctions) putRuntime(runtime *goja.Runtime) {
+	resetGlobals(runtime, sf.globals)
+	sf.runtimes.Put(runtime)
+}
+
+func (sf *ScriptFunctions) call(name string, args ...interface{}) (interface{}, error) {
+
+	runtime, err := sf.getRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	defer sf.putRuntime(runtime)
+
+	fn, ok := goja.AssertFunction(runtime.Get(name))
+	if !ok {
+		return nil, fmt.Errorf("Function \"%s\" is not defined", name)
+	}
+
+	values := make([]goja.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, runtime.ToValue(arg))
+	}
+
+	result, err := fn(goja.Undefined(), values...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Export(), nil
+}
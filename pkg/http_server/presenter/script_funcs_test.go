@@ -0,0 +1,161 @@
+package presenter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func writeScript(t *testing.T, source string) string {
+
+	dir, err := ioutil.TempDir("", "presenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "funcs.js"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestScriptFunctions(t *testing.T) {
+
+	dir := writeScript(t, `
+var prefix = "**";
+function maskName(name) { return name.substring(0, 1) + prefix; }
+function sum_2(a, b) { return a + b; }
+`)
+
+	presenter := &Presenter{}
+	funcs, err := presenter.loadFuncs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := funcs["prefix"]; ok {
+		t.Error("variable is loaded as function")
+	}
+
+	tmpl, err := template.New("test").Funcs(funcs).Parse(`{{ maskName "Alice" }} {{ sum_2 1 2 }} {{ upper "x" }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != "A** 3 X" {
+		t.Errorf("result = %q", buf.String())
+	}
+}
+
+func TestScriptFunctionsInvalidName(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{"dollar", `function $fmt(v) { return v; }`, `Invalid name of template function "$fmt"`},
+		{"dollar inside", `var fmt$ = function(v) { return v; };`, `Invalid name of template function "fmt$"`},
+		{"template function", `function upper(v) { return v; }`, `Template function "upper" is already defined`},
+		{"template builtin", `function len(v) { return 0; }`, `Template function "len" is already defined`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			presenter := &Presenter{}
+			_, err := presenter.loadFuncs(writeScript(t, test.source))
+			if err == nil {
+				t.Fatal("loading functions is expected to fail")
+			}
+
+			if err.Error() != test.err {
+				t.Errorf("error = %q, want %q", err.Error(), test.err)
+			}
+		})
+	}
+}
+
+func TestIsFuncName(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"maskName", true},
+		{"_private", true},
+		{"sum2", true},
+		{"名字", true},
+		{"", false},
+		{"2sum", false},
+		{"$fmt", false},
+		{"mask-name", false},
+		{"mask.name", false},
+	}
+
+	for _, test := range tests {
+		if isFuncName(test.name) != test.valid {
+			t.Errorf("isFuncName(%q) = %v, want %v", test.name, !test.valid, test.valid)
+		}
+	}
+}
+
+func TestScriptFunctionsGlobals(t *testing.T) {
+
+	sf := NewScriptFunctions()
+	if err := sf.Load(writeScript(t, `
+function remember(v) { last = v; return v; }
+function recall() { return typeof last === "undefined" ? "" : last; }
+`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sf.call("remember", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Globals set by the previous call are removed, functions defined by scripts are kept
+	value, err := sf.call("recall")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != "" {
+		t.Errorf("recall() = %v, want nothing", value)
+	}
+}
+
+func TestScriptFunctionsRuntimeFailure(t *testing.T) {
+
+	sf := NewScriptFunctions()
+	if err := sf.Load(writeScript(t, `function hello() { return "hello"; }`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pool is drained, and a new runtime fails to run scripts
+	sf.runtimes.Get()
+
+	program, err := CompileScript("failure.js", `throw new Error("failure");`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sf.programs = append(sf.programs, program)
+
+	if _, err := sf.call("hello"); err == nil || !strings.Contains(err.Error(), "failure") {
+		t.Errorf("error = %v", err)
+	}
+}
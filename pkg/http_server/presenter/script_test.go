@@ -0,0 +1,96 @@
+package presenter
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRuntimePoolResetsGlobals(t *testing.T) {
+
+	rp := NewRuntimePool()
+
+	runtime := rp.Get()
+	runtime.Set("records", []map[string]interface{}{{"secret": "alice"}})
+	_, err := runtime.RunString(`var leaked = records[0].secret; implicit = 1; function helper() { return leaked }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rp.reset(runtime)
+
+	for _, name := range []string{"records", "leaked", "implicit", "helper"} {
+		value, err := runtime.RunString(`typeof ` + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value.String() != "undefined" {
+			t.Errorf("global %q is %s after reset", name, value.String())
+		}
+	}
+
+	// Built-in functions are kept
+	if _, ok := goja.AssertFunction(runtime.Get("fail")); !ok {
+		t.Error("fail is removed by reset")
+	}
+}
+
+func newBenchmarkRequest(b *testing.B) *RequestContext {
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/accounts?phone=0912345678", nil)
+
+	rc, err := NewRequestContext(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return rc
+}
+
+func BenchmarkPooledRuntime(b *testing.B) {
+
+	rc := newBenchmarkRequest(b)
+	program, err := CompileScript("value", "parseInt(query.phone)")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	rp := NewRuntimePool()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		runtime := rp.Get()
+		rc.Apply(runtime)
+		if _, err := runtime.RunProgram(program); err != nil {
+			b.Fatal(err)
+		}
+		rp.Put(runtime)
+	}
+}
+
+func BenchmarkFreshRuntime(b *testing.B) {
+
+	rc := newBenchmarkRequest(b)
+	program, err := CompileScript("value", "parseInt(query.phone)")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		runtime := newRuntime()
+		rc.Apply(runtime)
+		if _, err := runtime.RunProgram(program); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
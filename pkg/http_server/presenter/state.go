@@ -0,0 +1,644 @@
+package presenter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+
+	"github.com/dop251/goja"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+type ResponseConfig struct {
+	ContentType string                     `json:"contentType"`
+	State       map[string]StateDefinition `json:"state"`
+	stateOrder  []string
+}
+
+type StateDefinition struct {
+	Representation  `mapstructure:",squash"`
+	Code            int                        `json:"code"`
+	When            string                     `json:"when"`
+	Headers         map[string]*HeaderValue    `json:"headers"`
+	CacheControl    string                     `json:"cacheControl"`
+	Representations map[string]*Representation `json:"representations"`
+	whenProgram     *goja.Program
+
+	// Available representations, the default one is the first
+	representations       []*Representation
+	defaultRepresentation *Representation
+}
+
+// HeaderValue is a string or an object with script to generate value
+type HeaderValue struct {
+	Value   string `json:"value"`
+	Script  string `json:"script"`
+	program *goja.Program
+}
+
+var defaultStates = map[string]StateDefinition{
+	"success": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: 200,
+	},
+	"no_results": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: 404,
+	},
+}
+
+// Error states are optional, built-in response will be used if they are not defined
+var errorStates = map[string]StateDefinition{
+	"bad_request": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusBadRequest,
+	},
+	"unauthorized": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusUnauthorized,
+	},
+	"not_found_route": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusNotFound,
+	},
+	"rate_limited": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusTooManyRequests,
+	},
+	"error": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusInternalServerError,
+	},
+	"not_acceptable": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusNotAcceptable,
+	},
+	"service_unavailable": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusServiceUnavailable,
+	},
+	"timeout": StateDefinition{
+		Representation: Representation{
+			ContentType: "application/json",
+		},
+		Code: http.StatusGatewayTimeout,
+	},
+}
+
+type ErrorData struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// StateError makes response with specific state
+type StateError struct {
+	State   string
+	Kind    string
+	Message string
+	Errors  []*ValidationError
+}
+
+func NewStateError(state string, kind string, err error) *StateError {
+	return &StateError{
+		State:   state,
+		Kind:    kind,
+		Message: err.Error(),
+	}
+}
+
+func (e *StateError) Error() string {
+	return e.Message
+}
+
+// scriptError finds out state which was selected by fail() of script
+func scriptError(state string, kind string, err error) *StateError {
+
+	if exception, ok := err.(*goja.Exception); ok {
+		if obj, ok := exception.Value().(*goja.Object); ok {
+			if value := obj.Get("value"); value != nil {
+				if e, ok := value.Export().(*StateError); ok {
+					return e
+				}
+			}
+		}
+	}
+
+	return NewStateError(state, kind, err)
+}
+
+// UnmarshalJSON keeps the declared order of states for evaluating conditions
+func (config *ResponseConfig) UnmarshalJSON(data []byte) error {
+
+	type responseConfig ResponseConfig
+	err := json.Unmarshal(data, (*responseConfig)(config))
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]json.RawMessage
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	stateData, ok := raw["state"]
+	if !ok {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(stateData))
+
+	// Skip beginning of object
+	if _, err := decoder.Token(); err != nil {
+		return err
+	}
+
+	config.stateOrder = make([]string, 0, len(config.State))
+	for decoder.More() {
+
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		config.stateOrder = append(config.stateOrder, token.(string))
+
+		// Skip value
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (hv *HeaderValue) UnmarshalJSON(data []byte) error {
+
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		hv.Value = value
+		return nil
+	}
+
+	type headerValue HeaderValue
+	return json.Unmarshal(data, (*headerValue)(hv))
+}
+
+// stateConfigHook converts settings in config file to be the same with endpoint settings
+func stateConfigHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+
+	switch to {
+	case reflect.TypeOf(HeaderValue{}):
+		if from.Kind() == reflect.String {
+			return HeaderValue{
+				Value: data.(string),
+			}, nil
+		}
+	case reflect.TypeOf(CSVColumn{}):
+		if from.Kind() == reflect.String {
+			return CSVColumn{
+				Name: data.(string),
+			}, nil
+		}
+	case reflect.TypeOf(json.RawMessage{}):
+		return json.Marshal(data)
+	}
+
+	return data, nil
+}
+
+func (state *StateDefinition) Load(dirPath string, defaultName string, funcs map[string]interface{}) error {
+
+	err := state.compile()
+	if err != nil {
+		return err
+	}
+
+	state.representations = make([]*Representation, 0, len(state.Representations)+1)
+
+	// Template of state itself is used if there is no other representation
+	if len(state.Representations) == 0 || len(state.Template) > 0 || len(state.Render) > 0 {
+
+		err := state.Representation.Load(dirPath, defaultName, funcs)
+		if err != nil {
+			return err
+		}
+
+		state.representations = append(state.representations, &state.Representation)
+	}
+
+	mediaTypes := make([]string, 0, len(state.Representations))
+	for mediaType := range state.Representations {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+
+	sort.Strings(mediaTypes)
+
+	for _, mediaType := range mediaTypes {
+
+		rep := state.Representations[mediaType]
+		if len(rep.ContentType) == 0 {
+			rep.ContentType = mediaType
+		}
+
+		err := rep.Load(dirPath, defaultName, funcs)
+		if err != nil {
+			return err
+		}
+
+		// Representation which matches content type of state is the default one
+		if len(state.representations) > 0 && state.representations[0] != &state.Representation && rep.mediaType == state.mediaType() {
+			state.representations = append([]*Representation{rep}, state.representations...)
+			continue
+		}
+
+		state.representations = append(state.representations, rep)
+	}
+
+	state.defaultRepresentation = state.representations[0]
+
+	return nil
+}
+
+// mediaType returns media type of content type which is declared by state
+func (state *StateDefinition) mediaType() string {
+
+	if len(state.ContentType) == 0 {
+		return "application/json"
+	}
+
+	mediaType, _, err := mime.ParseMediaType(state.ContentType)
+	if err != nil {
+		return state.ContentType
+	}
+
+	return mediaType
+}
+
+// loadGlobalStates loads error states in config file which are shared by all endpoints
+func loadGlobalStates(settingsPath string, funcs map[string]interface{}) (map[string]*StateDefinition, error) {
+
+	var configs map[string]StateDefinition
+	err := viper.UnmarshalKey("states", &configs, viper.DecodeHook(stateConfigHook))
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]*StateDefinition, len(configs))
+	for stateName, state := range configs {
+
+		if len(state.Template) == 0 && len(state.Representations) == 0 {
+			return nil, fmt.Errorf("Required template for state \"%s\"", stateName)
+		}
+
+		state := state
+		state.applyDefaults(stateName)
+
+		err := state.Load(settingsPath, stateName, funcs)
+		if err != nil {
+			return nil, err
+		}
+
+		states[stateName] = &state
+	}
+
+	return states, nil
+}
+
+func (state *StateDefinition) compile() error {
+
+	if len(state.When) > 0 {
+		program, err := CompileScript("when", state.When)
+		if err != nil {
+			return err
+		}
+
+		state.whenProgram = program
+	}
+
+	for name, header := range state.Headers {
+
+		if len(header.Script) == 0 {
+			continue
+		}
+
+		program, err := CompileScript(name, header.Script)
+		if err != nil {
+			return err
+		}
+
+		header.program = program
+	}
+
+	return nil
+}
+
+func (state *StateDefinition) applyDefaults(stateName string) {
+
+	// Custom states are successful by default
+	defState, ok := errorStates[stateName]
+	if !ok {
+		defState = defaultStates["success"]
+	}
+
+	if state.Code == 0 {
+		state.Code = defState.Code
+	}
+}
+
+func (endpoint *Endpoint) InitStates() error {
+
+	for stateName, defState := range defaultStates {
+
+		state, ok := endpoint.response.State[stateName]
+		if !ok {
+
+			// Empty results are responded with the success state if no_results is not declared
+			if _, ok := endpoint.response.State["success"]; ok && stateName == "no_results" {
+				continue
+			}
+
+			state = defState
+		}
+
+		if state.Code == 0 {
+			state.Code = 200
+		}
+
+		err := state.Load(endpoint.dirPath, endpoint.name, endpoint.funcs)
+		if err != nil {
+			return err
+		}
+
+		endpoint.states[stateName] = &state
+	}
+
+	// Sharing representations which are loaded already
+	if _, ok := endpoint.states["no_results"]; !ok {
+		endpoint.states["no_results"] = endpoint.states["success"]
+	}
+
+	// Error states and custom states
+	for stateName, state := range endpoint.response.State {
+
+		if _, ok := defaultStates[stateName]; ok {
+			continue
+		}
+
+		state := state
+		state.applyDefaults(stateName)
+
+		err := state.Load(endpoint.dirPath, endpoint.name, endpoint.funcs)
+		if err != nil {
+			return err
+		}
+
+		endpoint.states[stateName] = &state
+	}
+
+	// States with conditions are evaluated in declared order
+	endpoint.conditionalStates = make([]string, 0)
+	for _, stateName := range endpoint.response.stateOrder {
+		if state, ok := endpoint.states[stateName]; ok && state.whenProgram != nil {
+			endpoint.conditionalStates = append(endpoint.conditionalStates, stateName)
+		}
+	}
+
+	return nil
+}
+
+// selectState returns the first state which condition is satisfied
+func (endpoint *Endpoint) selectState(runtime *goja.Runtime, data *ViewData) (string, error) {
+
+	if len(endpoint.conditionalStates) == 0 {
+		return "", nil
+	}
+
+	data.loadRecords()
+	runtime.Set("records", data.Records)
+
+	for _, stateName := range endpoint.conditionalStates {
+
+		result, err := runtime.RunProgram(endpoint.states[stateName].whenProgram)
+		if err != nil {
+			return "", err
+		}
+
+		if result.ToBoolean() {
+			return stateName, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (endpoint *Endpoint) getState(stateName string) *StateDefinition {
+
+	if state, ok := endpoint.states[stateName]; ok {
+		return state
+	}
+
+	if state, ok := endpoint.global[stateName]; ok {
+		return state
+	}
+
+	return nil
+}
+
+func (endpoint *Endpoint) render(c *gin.Context, rc *RequestContext, runtime *goja.Runtime, stateName string, data *ViewData) {
+
+	state := endpoint.getState(stateName)
+
+	endpoint.applyHeaders(c, rc, runtime, state, data)
+	err := renderState(c, state, data)
+	if err != nil {
+		endpoint.renderFailed(c, rc, runtime, state, err)
+	}
+}
+
+// renderFailed logs error of template and responds with error state instead
+func (endpoint *Endpoint) renderFailed(c *gin.Context, rc *RequestContext, runtime *goja.Runtime, state *StateDefinition, err error) {
+
+	log.WithFields(log.Fields{
+		"endpoint":  endpoint.name,
+		"template":  renderedTemplate(err),
+		"requestID": rc.RequestID,
+	}).Error(err)
+
+	clearHeaders(c, state)
+
+	endpoint.renderError(c, rc, runtime, NewStateError("error", "template", err))
+}
+
+func (endpoint *Endpoint) renderError(c *gin.Context, rc *RequestContext, runtime *goja.Runtime, e *StateError) {
+
+	log.WithFields(log.Fields{
+		"endpoint":  endpoint.name,
+		"state":     e.State,
+		"kind":      e.Kind,
+		"requestID": rc.RequestID,
+	}).Error(e.Message)
+
+	data := &ViewData{
+		Errors: e.Errors,
+		Error: &ErrorData{
+			Kind:    e.Kind,
+			Message: e.Message,
+		},
+		RequestID: rc.RequestID,
+	}
+
+	state := endpoint.getState(e.State)
+	if state == nil {
+		renderBuiltinError(c, e.State, data)
+		return
+	}
+
+	endpoint.applyHeaders(c, rc, runtime, state, data)
+	err := renderState(c, state, data)
+	if err != nil {
+
+		// Error state is broken, built-in response is the last resort
+		log.WithFields(log.Fields{
+			"endpoint":  endpoint.name,
+			"state":     e.State,
+			"template":  renderedTemplate(err),
+			"requestID": rc.RequestID,
+		}).Error(err)
+
+		clearHeaders(c, state)
+		renderBuiltinError(c, e.State, data)
+		return
+	}
+
+	c.Abort()
+}
+
+// applyHeaders sets headers of state, values are generated by scripts with records and request
+func (endpoint *Endpoint) applyHeaders(c *gin.Context, rc *RequestContext, runtime *goja.Runtime, state *StateDefinition, data *ViewData) {
+
+	if len(state.CacheControl) > 0 {
+		c.Header("Cache-Control", state.CacheControl)
+	}
+
+	for name, header := range state.Headers {
+
+		if header.program == nil {
+			c.Header(name, header.Value)
+			continue
+		}
+
+		if runtime == nil {
+			runtime = endpoint.runtimes.Get()
+			defer endpoint.runtimes.Put(runtime)
+
+			rc.Apply(runtime)
+		}
+
+		data.loadRecords()
+		runtime.Set("records", data.Records)
+
+		result, err := runtime.RunProgram(header.program)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"endpoint": endpoint.name,
+				"header":   name,
+			}).Error(err)
+			continue
+		}
+
+		c.Header(name, result.String())
+	}
+}
+
+// renderState renders data with representation which is acceptable to client
+func renderState(c *gin.Context, state *StateDefinition, data *ViewData) error {
+
+	if len(state.representations) > 1 {
+		c.Header("Vary", "Accept")
+	}
+
+	rep := state.negotiate(c)
+	if rep == nil {
+		renderBuiltinError(c, "not_acceptable", &ViewData{
+			Error: &ErrorData{
+				Kind:    "negotiation",
+				Message: "No acceptable representation",
+			},
+			RequestID: data.RequestID,
+		})
+		return nil
+	}
+
+	return rep.render(c, state.Code, data)
+}
+
+// renderedTemplate returns template file which failed to be rendered
+func renderedTemplate(err error) string {
+
+	if e, ok := err.(*RenderError); ok {
+		return e.Template
+	}
+
+	return ""
+}
+
+// clearHeaders removes headers which were set for state
+func clearHeaders(c *gin.Context, state *StateDefinition) {
+
+	header := c.Writer.Header()
+	for name := range state.Headers {
+		header.Del(name)
+	}
+
+	header.Del("Vary")
+	header.Del("Content-Disposition")
+	header.Del("Cache-Control")
+}
+
+func renderBuiltinError(c *gin.Context, stateName string, data *ViewData) {
+
+	defState, ok := errorStates[stateName]
+	if !ok {
+		defState = errorStates["error"]
+	}
+
+	body := gin.H{
+		"error": gin.H{
+			"kind":      data.Error.Kind,
+			"message":   data.Error.Message,
+			"requestId": data.RequestID,
+		},
+	}
+
+	if len(data.Errors) > 0 {
+		body["errors"] = data.Errors
+	}
+
+	c.AbortWithStatusJSON(defState.Code, body)
+}
@@ -0,0 +1,396 @@
+package presenter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const statesEndpoint = `{
+	"method": "get",
+	"uri": "/accounts",
+	"query": {
+		"table": "accounts"
+	},
+	"response": {
+		"state": {
+			"success": {
+				"template": "success.tmpl"
+			},
+			"vip": {
+				"code": 200,
+				"when": "records.length > 10",
+				"template": "vip.tmpl"
+			},
+			"empty": {
+				"code": 204,
+				"when": "records.length == 0",
+				"template": "empty.tmpl"
+			},
+			"bad_request": {
+				"template": "bad_request.tmpl"
+			}
+		}
+	}
+}`
+
+func loadTestEndpoint(t *testing.T, config string, templates map[string]string) *Endpoint {
+
+	dir, err := ioutil.TempDir("", "presenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	filename := filepath.Join(dir, "endpoint.json")
+	if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range templates {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	endpoint := NewEndpoint(&Presenter{dataSources: NewDataSources()}, "endpoint")
+	if err := endpoint.Load(filename); err != nil {
+		t.Fatal(err)
+	}
+
+	return endpoint
+}
+
+func TestInitStatesKeepsEachState(t *testing.T) {
+
+	endpoint := loadTestEndpoint(t, statesEndpoint, map[string]string{
+		"success.tmpl":     `{"state":"success"}`,
+		"vip.tmpl":         `{"state":"vip"}`,
+		"empty.tmpl":       `{"state":"empty"}`,
+		"bad_request.tmpl": `{"envelope":"bad_request"}`,
+	})
+
+	tests := []struct {
+		name string
+		code int
+		when bool
+	}{
+		{"vip", 200, true},
+		{"empty", 204, true},
+		{"bad_request", 400, false},
+	}
+
+	for _, test := range tests {
+
+		state, ok := endpoint.states[test.name]
+		if !ok {
+			t.Fatalf("state %q is not loaded", test.name)
+		}
+
+		if state.Code != test.code {
+			t.Errorf("state %q: code = %d, want %d", test.name, state.Code, test.code)
+		}
+
+		if (state.whenProgram != nil) != test.when {
+			t.Errorf("state %q: compiled when = %v, want %v", test.name, state.whenProgram != nil, test.when)
+		}
+
+		if len(state.representations) == 0 {
+			t.Errorf("state %q has no representation", test.name)
+		}
+	}
+
+	if endpoint.states["vip"] == endpoint.states["empty"] || endpoint.states["empty"] == endpoint.states["bad_request"] {
+		t.Fatal("states share the same definition")
+	}
+
+	if len(endpoint.conditionalStates) != 2 {
+		t.Errorf("conditional states = %v, want vip and empty", endpoint.conditionalStates)
+	}
+
+	// Declared error state is rendered with its own template
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts", nil)
+
+	err := renderState(c, endpoint.states["bad_request"], &ViewData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("code = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if body := w.Body.String(); body != `{"envelope":"bad_request"}` {
+		t.Errorf("body = %s", body)
+	}
+}
+
+// failingBackend fails queries of tables with errors, other tables have no records
+type failingBackend struct {
+	errs map[string]error
+}
+
+func (backend *failingBackend) Init(section string) error {
+	return nil
+}
+
+func (backend *failingBackend) Query(ctx context.Context, table string, condition *Condition, option *QueryOption) (*querykit.QueryReply, error) {
+
+	if err, ok := backend.errs[table]; ok {
+		return nil, err
+	}
+
+	return &querykit.QueryReply{
+		Success: true,
+		Records: make([]*querykit.Record, 0),
+	}, nil
+}
+
+func (backend *failingBackend) Timeout() time.Duration {
+	return 0
+}
+
+func (backend *failingBackend) Stats() interface{} {
+	return nil
+}
+
+func (backend *failingBackend) Close(ctx context.Context) error {
+	return nil
+}
+
+var queryErrors = map[string]error{
+	"timeout":     context.DeadlineExceeded,
+	"deadline":    status.Error(codes.DeadlineExceeded, "deadline exceeded"),
+	"unavailable": status.Error(codes.Unavailable, "unavailable"),
+	"circuit":     ErrCircuitOpen,
+	"scan":        ErrScanLimitExceeded,
+	"broken":      errors.New("broken"),
+}
+
+func errorStateSettings(states string) map[string]string {
+
+	settings := map[string]string{
+		"forbidden.tmpl": `{"forbidden":"{{ .Error.Message }}"}`,
+	}
+
+	endpoint := func(method string, uri string, table string, value string, states string) string {
+
+		condition := ""
+		if len(value) > 0 {
+			condition = fmt.Sprintf(`, "condition": { "name": "id", "value": %q }`, value)
+		}
+
+		return fmt.Sprintf(`{
+			"method": %q,
+			"uri": %q,
+			"query": { "table": %q%s },
+			"response": {
+				"state": {
+					"success": { "render": "json" }%s
+				}
+			}
+		}`, method, uri, table, condition, states)
+	}
+
+	for table := range queryErrors {
+		settings[table+".json"] = endpoint("get", "/"+table, table, "", states)
+	}
+
+	settings["script.json"] = endpoint("get", "/script", "accounts", "query.token ? query.token : fail('unauthorized', 'Token is required')", "")
+	settings["custom.json"] = endpoint("get", "/custom", "accounts", "fail('forbidden', 'Not allowed')", `, "forbidden": { "code": 403, "template": "forbidden.tmpl" }`)
+	settings["undeclared.json"] = endpoint("get", "/undeclared", "accounts", "fail('missing', 'Unknown state')", "")
+	settings["exception.json"] = endpoint("get", "/exception", "accounts", "nothing.id", "")
+	settings["body.json"] = endpoint("post", "/body", "accounts", "body.id", "")
+
+	return settings
+}
+
+func TestErrorStates(t *testing.T) {
+
+	presenter := loadTestPresenter(t, errorStateSettings(""), &failingBackend{errs: queryErrors})
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		code    int
+		kind    string
+		message string
+	}{
+		{"timeout", "GET", "/timeout", "", 504, "timeout", "context deadline exceeded"},
+		{"deadline of querykit", "GET", "/deadline", "", 504, "timeout", ""},
+		{"unavailable", "GET", "/unavailable", "", 503, "unavailable", ""},
+		{"circuit open", "GET", "/circuit", "", 503, "unavailable", ErrCircuitOpen.Error()},
+		{"scan limit", "GET", "/scan", "", 500, "query", ErrScanLimitExceeded.Error()},
+		{"query failed", "GET", "/broken", "", 500, "query", "broken"},
+		{"fail", "GET", "/script", "", 401, "script", "Token is required"},
+		{"fail undeclared state", "GET", "/undeclared", "", 500, "script", "Unknown state"},
+		{"exception", "GET", "/exception", "", 400, "script", ""},
+		{"malformed body", "POST", "/body", `{ "id": `, 400, "request", ""},
+		{"unknown route", "GET", "/unknown", "", 404, "route", "Route not found"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := serveTest(presenter, req)
+			if w.Code != test.code {
+				t.Fatalf("code = %d, want %d, body = %s", w.Code, test.code, w.Body.String())
+			}
+
+			// Built-in JSON document is returned without error states
+			var body struct {
+				Error struct {
+					Kind      string `json:"kind"`
+					Message   string `json:"message"`
+					RequestID string `json:"requestId"`
+				} `json:"error"`
+			}
+
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body = %s, %v", w.Body.String(), err)
+			}
+
+			if body.Error.Kind != test.kind {
+				t.Errorf("kind = %s, want %s", body.Error.Kind, test.kind)
+			}
+
+			if len(test.message) > 0 && body.Error.Message != test.message {
+				t.Errorf("message = %s, want %s", body.Error.Message, test.message)
+			}
+
+			if len(body.Error.RequestID) == 0 || body.Error.RequestID != w.Header().Get(RequestIDHeader) {
+				t.Errorf("request ID = %q, header = %q", body.Error.RequestID, w.Header().Get(RequestIDHeader))
+			}
+		})
+	}
+
+	// Script which doesn't fail
+	w := serveTest(presenter, httptest.NewRequest(http.MethodGet, "/script?token=1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("code = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// State declared by endpoint
+	w = serveTest(presenter, httptest.NewRequest(http.MethodGet, "/custom", nil))
+	if w.Code != http.StatusForbidden || w.Body.String() != `{"forbidden":"Not allowed"}` {
+		t.Errorf("code = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGlobalErrorStates(t *testing.T) {
+
+	viper.Set("states", map[string]interface{}{
+		"timeout":             map[string]interface{}{"code": 503, "template": "timeout.tmpl"},
+		"not_found_route":     map[string]interface{}{"template": "not_found.tmpl"},
+		"service_unavailable": map[string]interface{}{"template": "global_unavailable.tmpl"},
+	})
+
+	t.Cleanup(func() {
+		viper.Set("states", nil)
+	})
+
+	settings := errorStateSettings(`, "service_unavailable": { "template": "endpoint_unavailable.tmpl" }`)
+	settings["timeout.tmpl"] = `{"global":"{{ .Error.Kind }}"}`
+	settings["not_found.tmpl"] = `{"global":"{{ .Error.Kind }}"}`
+	settings["global_unavailable.tmpl"] = `{"global":"{{ .Error.Kind }}"}`
+	settings["endpoint_unavailable.tmpl"] = `{"endpoint":"{{ .Error.Kind }}"}`
+
+	presenter := loadTestPresenter(t, settings, &failingBackend{errs: queryErrors})
+
+	tests := []struct {
+		name string
+		url  string
+		code int
+		body string
+	}{
+		{"global state with code", "/timeout", 503, `{"global":"timeout"}`},
+		{"global state of route", "/unknown", 404, `{"global":"route"}`},
+		{"state of endpoint overrides global state", "/unavailable", 503, `{"endpoint":"unavailable"}`},
+		{"built-in state", "/script", 401, `{"error":{"kind":"script","message":"Token is required","requestId":"req-1"}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			req := httptest.NewRequest(http.MethodGet, test.url, nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+
+			w := serveTest(presenter, req)
+			if w.Code != test.code {
+				t.Fatalf("code = %d, want %d, body = %s", w.Code, test.code, w.Body.String())
+			}
+
+			if w.Body.String() != test.body {
+				t.Errorf("body = %s, want %s", w.Body.String(), test.body)
+			}
+		})
+	}
+}
+
+func TestInitStatesNoResults(t *testing.T) {
+
+	endpoint := func(states string) string {
+		return fmt.Sprintf(`{
+			"method": "get",
+			"uri": "/accounts",
+			"query": { "table": "accounts" },
+			"response": { "state": { %s } }
+		}`, states)
+	}
+
+	success := `"success": {
+		"representations": {
+			"application/json": { "render": "json" },
+			"text/csv": { "render": "csv" }
+		}
+	}`
+
+	// Empty results are responded with the success state which is loaded
+	fallback := loadTestEndpoint(t, endpoint(success), nil)
+	if fallback.states["no_results"] != fallback.states["success"] {
+		t.Error("no_results is not the success state")
+	}
+
+	// Declared no_results has its own representations
+	declared := loadTestEndpoint(t, endpoint(success+`, "no_results": { "code": 404, "render": "json" }`), nil)
+	noResults := declared.states["no_results"]
+	if noResults == declared.states["success"] || noResults.Code != 404 || len(noResults.representations) != 1 {
+		t.Errorf("no_results = %+v", noResults)
+	}
+
+	if len(declared.states["success"].representations) != 2 {
+		t.Errorf("representations of success = %d, want 2", len(declared.states["success"].representations))
+	}
+
+	// Built-in no_results is used without success state
+	builtin := loadTestEndpoint(t, endpoint(""), map[string]string{"endpoint.tmpl": `{}`})
+	if builtin.states["no_results"] == builtin.states["success"] || builtin.states["no_results"].Code != 404 {
+		t.Errorf("no_results = %+v", builtin.states["no_results"])
+	}
+}
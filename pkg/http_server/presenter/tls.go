@@ -0,0 +1,294 @@
+package presenter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var ErrTokenRequiresTLS = errors.New("Bearer token requires TLS")
+
+// watchedFile is reloaded if it was modified
+type watchedFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// changed returns stat of file if it was modified, stat is recorded by commit after the file is loaded,
+// so file which is caught in the middle of writing is loaded again
+func (file *watchedFile) changed() (os.FileInfo, error) {
+
+	info, err := os.Stat(file.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.ModTime().Equal(file.modTime) && info.Size() == file.size {
+		return nil, nil
+	}
+
+	return info, nil
+}
+
+func (file *watchedFile) commit(info os.FileInfo) {
+	file.modTime = info.ModTime()
+	file.size = info.Size()
+}
+
+// certReloader provides certificates which are reloaded when files rotate
+type certReloader struct {
+	serverName string
+	ca         *watchedFile
+	cert       *watchedFile
+	key        *watchedFile
+
+	roots       *x509.CertPool
+	certificate *tls.Certificate
+	mutex       sync.Mutex
+}
+
+func newCertReloader(serverName string, caFile string, certFile string, keyFile string) (*certReloader, error) {
+
+	reloader := &certReloader{
+		serverName: serverName,
+	}
+
+	if len(caFile) > 0 {
+		reloader.ca = &watchedFile{path: caFile}
+		if _, err := reloader.getRoots(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		if len(certFile) == 0 || len(keyFile) == 0 {
+			return nil, errors.New("Both of client certificate and key are required")
+		}
+
+		reloader.cert = &watchedFile{path: certFile}
+		reloader.key = &watchedFile{path: keyFile}
+		if _, err := reloader.getClientCertificate(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return reloader, nil
+}
+
+func (reloader *certReloader) getRoots() (*x509.CertPool, error) {
+
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	info, err := reloader.ca.changed()
+	if err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		return reloader.roots, nil
+	}
+
+	data, err := ioutil.ReadFile(reloader.ca.path)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("No certificate in CA file \"%s\"", reloader.ca.path)
+	}
+
+	reloader.roots = roots
+	reloader.ca.commit(info)
+
+	return roots, nil
+}
+
+func (reloader *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	certInfo, err := reloader.cert.changed()
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo, err := reloader.key.changed()
+	if err != nil {
+		return nil, err
+	}
+
+	if certInfo == nil && keyInfo == nil {
+		return reloader.certificate, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.cert.path, reloader.key.path)
+	if err != nil {
+		return nil, err
+	}
+
+	reloader.certificate = &certificate
+
+	if certInfo != nil {
+		reloader.cert.commit(certInfo)
+	}
+
+	if keyInfo != nil {
+		reloader.key.commit(keyInfo)
+	}
+
+	return reloader.certificate, nil
+}
+
+// verifyPeerCertificate verifies server with the latest CA
+func (reloader *certReloader) verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+
+	roots, err := reloader.getRoots()
+	if err != nil {
+		return err
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return errors.New("No certificate from server")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		DNSName:       reloader.serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+
+	return err
+}
+
+// tokenCredentials adds bearer token to each call, token file is reloaded if it was modified
+type tokenCredentials struct {
+	token string
+	file  *watchedFile
+	mutex sync.Mutex
+}
+
+func (creds *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+
+	creds.mutex.Lock()
+	defer creds.mutex.Unlock()
+
+	if creds.file != nil {
+		info, err := creds.file.changed()
+		if err != nil {
+			return nil, err
+		}
+
+		if info != nil {
+			data, err := ioutil.ReadFile(creds.file.path)
+			if err != nil {
+				return nil, err
+			}
+
+			creds.token = strings.TrimSpace(string(data))
+			creds.file.commit(info)
+		}
+	}
+
+	return map[string]string{
+		"authorization": "Bearer " + creds.token,
+	}, nil
+}
+
+func (creds *tokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
+
+// dialOptions prepares transport security and credentials with settings of data source
+func dialOptions(section string, host string) ([]grpc.DialOption, error) {
+
+	setting := func(name string) string {
+		return section + "." + name
+	}
+
+	options := make([]grpc.DialOption, 0)
+
+	// Bearer token for each call
+	token := viper.GetString(setting("token"))
+	tokenFile := viper.GetString(setting("tokenFile"))
+	if len(token) > 0 || len(tokenFile) > 0 {
+
+		if !viper.GetBool(setting("tls.enabled")) {
+			return nil, ErrTokenRequiresTLS
+		}
+
+		creds := &tokenCredentials{
+			token: token,
+		}
+
+		if len(tokenFile) > 0 {
+			creds.file = &watchedFile{path: tokenFile}
+		}
+
+		options = append(options, grpc.WithPerRPCCredentials(creds))
+	}
+
+	if !viper.GetBool(setting("tls.enabled")) {
+		return append(options, grpc.WithInsecure()), nil
+	}
+
+	serverName := viper.GetString(setting("tls.serverName"))
+	if len(serverName) == 0 {
+		serverName = host
+	}
+
+	reloader, err := newCertReloader(
+		serverName,
+		viper.GetString(setting("tls.ca")),
+		viper.GetString(setting("tls.cert")),
+		viper.GetString(setting("tls.key")),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		ServerName: serverName,
+	}
+
+	if reloader.cert != nil {
+		config.GetClientCertificate = reloader.getClientCertificate
+	}
+
+	// Server is verified by ourselves with the latest CA instead of system roots
+	if reloader.ca != nil {
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = reloader.verifyPeerCertificate
+	}
+
+	return append(options, grpc.WithTransportCredentials(credentials.NewTLS(config))), nil
+}
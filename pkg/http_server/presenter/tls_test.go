@@ -0,0 +1,212 @@
+package presenter
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCertificate struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCertificate creates certificate which is signed by parent, or self-signed CA without parent
+func newTestCertificate(t *testing.T, name string, parent *testCertificate) *testCertificate {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCertificate{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// writeRotatedFile writes file with the given modification time, coarse timestamps of file systems are simulated
+func writeRotatedFile(t *testing.T, filename string, data []byte, modTime time.Time) {
+
+	if err := ioutil.WriteFile(filename, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(filename, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// inProgress is content of file which is being written in place, it has the same size as the complete one
+func inProgress(data []byte) []byte {
+
+	partial := make([]byte, len(data))
+	copy(partial, data[:len(data)/2])
+
+	return partial
+}
+
+func TestCertReloaderRotation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	oldCA := newTestCertificate(t, "ca", nil)
+	oldServer := newTestCertificate(t, "querykit", oldCA)
+	oldClient := newTestCertificate(t, "presenter", oldCA)
+
+	modTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	writeRotatedFile(t, caFile, oldCA.certPEM, modTime)
+	writeRotatedFile(t, certFile, oldClient.certPEM, modTime)
+	writeRotatedFile(t, keyFile, oldClient.keyPEM, modTime)
+
+	reloader, err := newCertReloader("querykit", caFile, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reloader.verifyPeerCertificate([][]byte{oldServer.cert.Raw}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert := func() []byte {
+		certificate, err := reloader.getClientCertificate(nil)
+		if err != nil {
+			return nil
+		}
+
+		return certificate.Certificate[0]
+	}
+
+	if !bytes.Equal(clientCert(), oldClient.cert.Raw) {
+		t.Fatal("client certificate is not loaded")
+	}
+
+	newCA := newTestCertificate(t, "ca", nil)
+	newServer := newTestCertificate(t, "querykit", newCA)
+	newClient := newTestCertificate(t, "presenter", newCA)
+
+	// Files are caught in the middle of rotation
+	rotated := modTime.Add(time.Second)
+	writeRotatedFile(t, caFile, inProgress(newCA.certPEM), rotated)
+	writeRotatedFile(t, certFile, newClient.certPEM, rotated)
+	writeRotatedFile(t, keyFile, inProgress(newClient.keyPEM), rotated)
+
+	if err := reloader.verifyPeerCertificate([][]byte{newServer.cert.Raw}, nil); err == nil {
+		t.Fatal("server is verified with CA which is incomplete")
+	}
+
+	if _, err := reloader.getClientCertificate(nil); err == nil {
+		t.Fatal("client certificate is loaded with key which is incomplete")
+	}
+
+	// Rotation is completed, files have the same sizes and timestamps as they were caught
+	writeRotatedFile(t, caFile, newCA.certPEM, rotated)
+	writeRotatedFile(t, keyFile, newClient.keyPEM, rotated)
+
+	if err := reloader.verifyPeerCertificate([][]byte{newServer.cert.Raw}, nil); err != nil {
+		t.Errorf("server is not verified with the new CA: %v", err)
+	}
+
+	if err := reloader.verifyPeerCertificate([][]byte{oldServer.cert.Raw}, nil); err == nil {
+		t.Error("server is verified with the old CA")
+	}
+
+	if !bytes.Equal(clientCert(), newClient.cert.Raw) {
+		t.Error("client certificate is not reloaded")
+	}
+}
+
+func TestTokenCredentialsRotation(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "token")
+	modTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	writeRotatedFile(t, filename, []byte("old-token\n"), modTime)
+
+	creds := &tokenCredentials{
+		file: &watchedFile{path: filename},
+	}
+
+	token := func() string {
+		metadata, err := creds.GetRequestMetadata(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return metadata["authorization"]
+	}
+
+	if value := token(); value != "Bearer old-token" {
+		t.Fatalf("authorization = %s", value)
+	}
+
+	writeRotatedFile(t, filename, []byte("new-token\n"), modTime.Add(time.Second))
+
+	if value := token(); value != "Bearer new-token" {
+		t.Errorf("authorization = %s", value)
+	}
+}
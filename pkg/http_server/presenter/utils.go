@@ -1,12 +1,8 @@
 package presenter
 
 import (
-	"encoding/binary"
-	"math"
 	"strconv"
 	"strings"
-
-	querykit "github.com/BrobridgeOrg/gravity-api/service/querykit"
 )
 
 func getValueFromObject(obj interface{}, targetPath string) interface{} {
@@ -32,10 +28,12 @@ func getValueFromObject(obj interface{}, targetPath string) interface{} {
 			}
 
 			arr := cursor.([]interface{})
-			if len(arr) > int(index) {
-				return arr[index]
+			if index < 0 || len(arr) <= int(index) {
+				return nil
 			}
 
+			cursor = arr[index]
+		default:
 			return nil
 		}
 	}
@@ -43,25 +41,35 @@ func getValueFromObject(obj interface{}, targetPath string) interface{} {
 	return cursor
 }
 
-func GetValue(value *querykit.Value) interface{} {
+func setValueToObject(obj interface{}, targetPath string, value interface{}) bool {
+
+	parts := strings.Split(targetPath, ".")
 
-	if value == nil {
-		return nil
+	cursor, ok := obj.(map[string]interface{})
+	if !ok {
+		return false
 	}
 
-	switch value.Type {
-	case querykit.DataType_FLOAT64:
-		return math.Float64frombits(binary.LittleEndian.Uint64(value.Value))
-	case querykit.DataType_INT64:
-		return int64(binary.LittleEndian.Uint64(value.Value))
-	case querykit.DataType_UINT64:
-		return uint64(binary.LittleEndian.Uint64(value.Value))
-	case querykit.DataType_BOOLEAN:
-		return int8(value.Value[0]) & 1
-	case querykit.DataType_STRING:
-		return string(value.Value)
+	for i, name := range parts {
+
+		if i == len(parts)-1 {
+			cursor[name] = value
+			return true
+		}
+
+		next, ok := cursor[name].(map[string]interface{})
+		if !ok {
+			if cursor[name] != nil {
+				return false
+			}
+
+			// Create parent object
+			next = make(map[string]interface{})
+			cursor[name] = next
+		}
+
+		cursor = next
 	}
 
-	// binary
-	return value.Value
+	return false
 }
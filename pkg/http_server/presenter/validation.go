@@ -0,0 +1,384 @@
+package presenter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+)
+
+var ErrRequired = errors.New("is required")
+
+type RequestConfig struct {
+	Params  map[string]*FieldRule `json:"params"`
+	Query   map[string]*FieldRule `json:"query"`
+	Headers map[string]*FieldRule `json:"headers"`
+	Body    map[string]*FieldRule `json:"body"`
+}
+
+type FieldRule struct {
+	Type     string        `json:"type"`
+	Required bool          `json:"required"`
+	Pattern  string        `json:"pattern"`
+	Min      *float64      `json:"min"`
+	Max      *float64      `json:"max"`
+	Enum     []interface{} `json:"enum"`
+	Default  interface{}   `json:"default"`
+	rules    []validation.Rule
+	pattern  *regexp.Regexp
+}
+
+type ValidationError struct {
+	In      string `json:"in"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (config *RequestConfig) Init() error {
+
+	// Header names are case-insensitive
+	headers := make(map[string]*FieldRule, len(config.Headers))
+	for name, rule := range config.Headers {
+		headers[strings.ToLower(name)] = rule
+	}
+	config.Headers = headers
+
+	sets := map[string]map[string]*FieldRule{
+		"params":  config.Params,
+		"query":   config.Query,
+		"headers": config.Headers,
+		"body":    config.Body,
+	}
+
+	for in, rules := range sets {
+		for name, rule := range rules {
+			err := rule.Init()
+			if err != nil {
+				return fmt.Errorf("Invalid rule for %s.%s: %v", in, name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Validate checks request and converts values to declared types, errors are sorted by field names.
+func (config *RequestConfig) Validate(rc *RequestContext) []*ValidationError {
+
+	errs := make([]*ValidationError, 0)
+
+	errs = append(errs, validateFields("params", config.Params, func(name string) interface{} {
+		return rc.Params[name]
+	}, func(name string, value interface{}) {
+		rc.Params[name] = value
+	})...)
+
+	errs = append(errs, validateFields("query", config.Query, func(name string) interface{} {
+
+		// All values of parameter which appears multiple times
+		if config.Query[name].Type == "array" {
+			if values, ok := rc.queryValues[name]; ok {
+				elements := make([]interface{}, 0, len(values))
+				for _, v := range values {
+					elements = append(elements, v)
+				}
+
+				return elements
+			}
+		}
+
+		return rc.Query[name]
+	}, func(name string, value interface{}) {
+		rc.Query[name] = value
+	})...)
+
+	errs = append(errs, validateFields("headers", config.Headers, func(name string) interface{} {
+		return rc.Headers[name]
+	}, func(name string, value interface{}) {
+		rc.Headers[name] = value
+	})...)
+
+	errs = append(errs, validateFields("body", config.Body, func(name string) interface{} {
+		return getValueFromObject(rc.Body, name)
+	}, func(name string, value interface{}) {
+		if rc.Body == nil {
+			rc.Body = make(map[string]interface{})
+		}
+
+		setValueToObject(rc.Body, name, value)
+	})...)
+
+	return errs
+}
+
+func validateFields(in string, rules map[string]*FieldRule, get func(string) interface{}, set func(string, interface{})) []*ValidationError {
+
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	errs := make([]*ValidationError, 0)
+	for _, name := range names {
+
+		value, err := rules[name].Validate(get(name))
+		if err != nil {
+			errs = append(errs, &ValidationError{
+				In:      in,
+				Field:   name,
+				Message: err.Error(),
+			})
+			continue
+		}
+
+		if value != nil {
+			set(name, value)
+		}
+	}
+
+	return errs
+}
+
+func (rule *FieldRule) Init() error {
+
+	switch rule.Type {
+	case "", "string", "integer", "number", "boolean", "array", "object":
+	default:
+		return fmt.Errorf("Unknown type \"%s\"", rule.Type)
+	}
+
+	if rule.Default != nil {
+		v, err := rule.convert(rule.Default)
+		if err != nil {
+			return fmt.Errorf("default value %v", err)
+		}
+
+		rule.Default = v
+	}
+
+	rule.rules = make([]validation.Rule, 0)
+
+	if len(rule.Pattern) > 0 {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return err
+		}
+
+		rule.pattern = re
+	}
+
+	// Enum values have to be the same type with value for comparison
+	if len(rule.Enum) > 0 {
+		elements := make([]interface{}, 0, len(rule.Enum))
+		for _, e := range rule.Enum {
+			v, err := rule.convert(e)
+			if err != nil {
+				return fmt.Errorf("enum value %v", err)
+			}
+
+			elements = append(elements, v)
+		}
+
+		rule.rules = append(rule.rules, validation.In(elements...).Error(fmt.Sprintf("must be one of %v", rule.Enum)))
+	}
+
+	return nil
+}
+
+// Validate returns value which is converted to declared type
+func (rule *FieldRule) Validate(value interface{}) (interface{}, error) {
+
+	if isEmptyValue(value) {
+
+		if rule.Default != nil {
+			return rule.Default, nil
+		}
+
+		if rule.Required {
+			return nil, ErrRequired
+		}
+
+		return nil, nil
+	}
+
+	// Pattern is checked with the original string before conversion
+	err := rule.matchPattern(value)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := rule.convert(value)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validation.Validate(v, rule.rules...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rule.validateRange(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// matchPattern checks strings and numbers with pattern, or each element of arrays
+func (rule *FieldRule) matchPattern(value interface{}) error {
+
+	if rule.pattern == nil {
+		return nil
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, ele := range v {
+			if !rule.pattern.MatchString(fmt.Sprint(ele)) {
+				return errors.New("must match pattern " + rule.Pattern)
+			}
+		}
+
+		return nil
+	case map[string]interface{}:
+		return errors.New("must match pattern " + rule.Pattern)
+	}
+
+	if !rule.pattern.MatchString(fmt.Sprint(value)) {
+		return errors.New("must match pattern " + rule.Pattern)
+	}
+
+	return nil
+}
+
+// validateRange checks numbers with its value, strings and arrays with its length
+func (rule *FieldRule) validateRange(value interface{}) error {
+
+	if rule.Min == nil && rule.Max == nil {
+		return nil
+	}
+
+	var size float64
+	unit := ""
+	switch v := value.(type) {
+	case int64:
+		size = float64(v)
+	case float64:
+		size = v
+	case string:
+		size = float64(len([]rune(v)))
+		unit = " characters"
+	case []interface{}:
+		size = float64(len(v))
+		unit = " items"
+	default:
+		return nil
+	}
+
+	if rule.Min != nil && size < *rule.Min {
+		return fmt.Errorf("must be no less than %v%s", *rule.Min, unit)
+	}
+
+	if rule.Max != nil && size > *rule.Max {
+		return fmt.Errorf("must be no greater than %v%s", *rule.Max, unit)
+	}
+
+	return nil
+}
+
+func (rule *FieldRule) convert(value interface{}) (interface{}, error) {
+
+	switch rule.Type {
+	case "integer":
+		switch v := value.(type) {
+		case string:
+			i, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return nil, errors.New("must be an integer")
+			}
+
+			return i, nil
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, errors.New("must be an integer")
+			}
+
+			return int64(v), nil
+		case int64:
+			return v, nil
+		}
+
+		return nil, errors.New("must be an integer")
+	case "number":
+		switch v := value.(type) {
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, errors.New("must be a number")
+			}
+
+			return f, nil
+		case float64:
+			return v, nil
+		case int64:
+			return float64(v), nil
+		}
+
+		return nil, errors.New("must be a number")
+	case "boolean":
+		switch v := value.(type) {
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, errors.New("must be a boolean")
+			}
+
+			return b, nil
+		case bool:
+			return v, nil
+		}
+
+		return nil, errors.New("must be a boolean")
+	case "string":
+		if v, ok := value.(string); ok {
+			return v, nil
+		}
+
+		return nil, errors.New("must be a string")
+	case "array":
+		if v, ok := value.([]interface{}); ok {
+			return v, nil
+		}
+
+		return nil, errors.New("must be an array")
+	case "object":
+		if v, ok := value.(map[string]interface{}); ok {
+			return v, nil
+		}
+
+		return nil, errors.New("must be an object")
+	}
+
+	return value, nil
+}
+
+func isEmptyValue(value interface{}) bool {
+
+	if value == nil {
+		return true
+	}
+
+	if s, ok := value.(string); ok && len(s) == 0 {
+		return true
+	}
+
+	return false
+}
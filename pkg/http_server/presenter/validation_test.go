@@ -0,0 +1,133 @@
+package presenter
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRule(t *testing.T, source string) *FieldRule {
+
+	rule := &FieldRule{}
+	if err := json.Unmarshal([]byte(source), rule); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rule.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return rule
+}
+
+func TestFieldRulePattern(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		rule  string
+		value interface{}
+		want  interface{}
+		err   string
+	}{
+		{"string", `{ "type": "string", "pattern": "^[0-9]+$" }`, "0912", "0912", ""},
+		{"string mismatch", `{ "type": "string", "pattern": "^[0-9]+$" }`, "09a", nil, "must match pattern ^[0-9]+$"},
+		{"integer", `{ "type": "integer", "pattern": "^[0-9]{4}$" }`, "2021", int64(2021), ""},
+		{"integer mismatch", `{ "type": "integer", "pattern": "^[0-9]{4}$" }`, "20211", nil, "must match pattern ^[0-9]{4}$"},
+		{"integer leading zero", `{ "type": "integer", "pattern": "^[1-9]" }`, "0123", nil, "must match pattern ^[1-9]"},
+		{"integer of body", `{ "type": "integer", "pattern": "^[0-9]{4}$" }`, float64(2021), int64(2021), ""},
+		{"number", `{ "type": "number", "pattern": "^[0-9]+\\.[0-9]{2}$" }`, "1.50", 1.5, ""},
+		{"boolean", `{ "type": "boolean", "pattern": "^(true|false)$" }`, "true", true, ""},
+		{"boolean mismatch", `{ "type": "boolean", "pattern": "^(true|false)$" }`, "1", nil, "must match pattern ^(true|false)$"},
+		{"array", `{ "type": "array", "pattern": "^[0-9]+$" }`, []interface{}{"1", "2"}, []interface{}{"1", "2"}, ""},
+		{"array mismatch", `{ "type": "array", "pattern": "^[0-9]+$" }`, []interface{}{"1", "x"}, nil, "must match pattern ^[0-9]+$"},
+		{"object", `{ "type": "object", "pattern": "^[0-9]+$" }`, map[string]interface{}{}, nil, "must match pattern ^[0-9]+$"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			value, err := newTestRule(t, test.rule).Validate(test.value)
+			if len(test.err) > 0 {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("error = %v, want %s", err, test.err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(value, test.want) {
+				t.Errorf("value = %#v, want %#v", value, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateArrayQuery(t *testing.T) {
+
+	config := &RequestConfig{}
+	err := json.Unmarshal([]byte(`{
+		"query": {
+			"id": { "type": "array", "required": true, "min": 2, "pattern": "^[0-9]+$" },
+			"type": { "type": "string" }
+		}
+	}`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		id    interface{}
+		errs  int
+	}{
+		{"multiple values", "id=1&id=2&type=a&type=b", []interface{}{"1", "2"}, 0},
+		{"single value", "id=1", nil, 1},
+		{"invalid element", "id=1&id=x", nil, 1},
+		{"absent", "type=a", nil, 1},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/accounts?"+test.query, nil)
+
+			rc, err := NewRequestContext(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errs := config.Validate(rc)
+			if len(errs) != test.errs {
+				t.Fatalf("errors = %d, want %d", len(errs), test.errs)
+			}
+
+			if test.errs > 0 {
+				return
+			}
+
+			if !reflect.DeepEqual(rc.Query["id"], test.id) {
+				t.Errorf("id = %#v, want %#v", rc.Query["id"], test.id)
+			}
+
+			// Parameters which are not arrays take the first value
+			if rc.Query["type"] != "a" {
+				t.Errorf("type = %#v, want a", rc.Query["type"])
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package presenter
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// Editors usually generate several events for one saving
+const reloadDelay = 500 * time.Millisecond
+
+type Watcher struct {
+	presenter *Presenter
+	watcher   *fsnotify.Watcher
+	done      chan struct{}
+}
+
+func NewWatcher(presenter *Presenter) *Watcher {
+	return &Watcher{
+		presenter: presenter,
+		done:      make(chan struct{}),
+	}
+}
+
+func (watcher *Watcher) Watch(settingsPath string) error {
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	watcher.watcher = w
+
+	// Watching all directories of settings
+	err = filepath.Walk(settingsPath, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		return w.Add(path)
+	})
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"path": settingsPath,
+	}).Info("Watching settings for changes")
+
+	go watcher.run()
+
+	return nil
+}
+
+func (watcher *Watcher) Close() {
+	close(watcher.done)
+	watcher.watcher.Close()
+}
+
+func (watcher *Watcher) run() {
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+
+	for {
+		select {
+		case <-watcher.done:
+			timer.Stop()
+			return
+		case event, ok := <-watcher.watcher.Events:
+			if !ok {
+				return
+			}
+
+			// Watching new directory
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					watcher.watcher.Add(event.Name)
+				}
+			}
+
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			timer.Reset(reloadDelay)
+		case err, ok := <-watcher.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Error(err)
+		case <-timer.C:
+			watcher.reload()
+		}
+	}
+}
+
+func (watcher *Watcher) reload() {
+
+	log.Info("Settings were changed, reloading endpoints")
+
+	err := watcher.presenter.Reload()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Error("Failed to reload endpoints, keep serving with previous settings")
+		return
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"net"
 	"net/http"
 
@@ -62,7 +63,8 @@ func (server *Server) Serve() error {
 	}).Info("Starting HTTP server")
 
 	// Starting server
-	if err := server.instance.Serve(server.listener); err != cmux.ErrListenerClosed {
+	err := server.instance.Serve(server.listener)
+	if err != cmux.ErrListenerClosed && err != http.ErrServerClosed {
 		log.Error(err)
 		return err
 	}
@@ -70,6 +72,16 @@ func (server *Server) Serve() error {
 	return nil
 }
 
+// Shutdown waits for requests in progress, then releases resources of presenter
+func (server *Server) Shutdown(ctx context.Context) error {
+
+	err := server.instance.Shutdown(ctx)
+
+	server.presenter.Uninit(ctx)
+
+	return err
+}
+
 func (server *Server) GetEngine() *gin.Engine {
 	return server.engine
 }